@@ -0,0 +1,150 @@
+package mynet
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var (
+	ErrTooManySessions   = errors.New("too many sessions")
+	ErrTooManySessionsIP = errors.New("too many sessions from the same ip")
+	ErrAddrDenied        = errors.New("remote address denied")
+)
+
+//admission 连接的准入控制, 在创建Codec之前检查
+type admission struct {
+	mutex         sync.Mutex
+	maxSessions   int            // 最大的Session数量, 0表示不限制
+	maxSessionsIP int            // 每个IP最大的Session数量, 0表示不限制
+	sessions      int            // 当前的Session数量
+	ipSessions    map[string]int // 每个IP当前的Session数量
+	allowList     []*net.IPNet   // 不为空时只允许列表中的地址
+	denyList      []*net.IPNet   // 拒绝的地址, 优先于allowList
+}
+
+//admit 检查一个新的连接, 通过后返回释放名额的函数
+func (a *admission) admit(addr net.Addr) (func(), error) {
+	var host = addrHost(addr)
+	var ip = net.ParseIP(host)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if ip != nil && containsIP(a.denyList, ip) {
+		return nil, ErrAddrDenied
+	}
+	if len(a.allowList) > 0 && (ip == nil || !containsIP(a.allowList, ip)) {
+		return nil, ErrAddrDenied
+	}
+	if a.maxSessions > 0 && a.sessions >= a.maxSessions {
+		return nil, ErrTooManySessions
+	}
+	if a.maxSessionsIP > 0 && a.ipSessions[host] >= a.maxSessionsIP {
+		return nil, ErrTooManySessionsIP
+	}
+
+	if a.ipSessions == nil {
+		a.ipSessions = make(map[string]int)
+	}
+	a.sessions++
+	a.ipSessions[host]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mutex.Lock()
+			defer a.mutex.Unlock()
+			a.sessions--
+			if a.ipSessions[host]--; a.ipSessions[host] <= 0 {
+				delete(a.ipSessions, host)
+			}
+		})
+	}, nil
+}
+
+//SetMaxSessions 设置最大的Session数量, 0表示不限制. 已经存在的Session不受影响
+func (s *Server) SetMaxSessions(n int) {
+	s.admission.mutex.Lock()
+	defer s.admission.mutex.Unlock()
+	s.admission.maxSessions = n
+}
+
+//SetMaxSessionsPerIP 设置每个IP最大的Session数量, 0表示不限制. 已经存在的Session不受影响
+func (s *Server) SetMaxSessionsPerIP(n int) {
+	s.admission.mutex.Lock()
+	defer s.admission.mutex.Unlock()
+	s.admission.maxSessionsIP = n
+}
+
+//SetAllowList 设置允许连接的CIDR列表(如 "10.0.0.0/8", 单个IP也可以), 为空时允许所有的地址
+//可以在运行时调用, 只对之后的新连接生效
+func (s *Server) SetAllowList(cidrs ...string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.admission.mutex.Lock()
+	defer s.admission.mutex.Unlock()
+	s.admission.allowList = nets
+	return nil
+}
+
+//SetDenyList 设置拒绝连接的CIDR列表, 优先于允许列表
+//可以在运行时调用, 只对之后的新连接生效
+func (s *Server) SetDenyList(cidrs ...string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.admission.mutex.Lock()
+	defer s.admission.mutex.Unlock()
+	s.admission.denyList = nets
+	return nil
+}
+
+//parseCIDRs 解析CIDR列表, 不带掩码的IP视为单个地址
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets = make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil {
+			var bits = 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//addrHost 获取地址中的host部分
+func addrHost(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	case nil:
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
@@ -0,0 +1,123 @@
+package mynet_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+//admitted 连接服务器, 返回服务器端的Session, 被拒绝时返回nil
+func admitted(t *testing.T, server *mynet.Server, sessions chan *mynet.Session) *mynet.Session {
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ses := <-sessions:
+		return ses
+	case <-time.After(100 * time.Millisecond):
+		// 被拒绝的连接会被直接关闭
+		if _, err = client.Receive(); err == nil {
+			t.Fatal("rejected connection should be closed")
+		}
+		return nil
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	var sessions = make(chan *mynet.Session, 16)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", serverTestProtocol(), 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		sessions <- s
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	server.SetMaxSessions(2)
+	s1 := admitted(t, server, sessions)
+	s2 := admitted(t, server, sessions)
+	s3 := admitted(t, server, sessions)
+	if s1 == nil || s2 == nil || s3 != nil {
+		t.Fatalf("max sessions not work: %v %v %v", s1, s2, s3)
+	}
+
+	// 关闭一个Session后可以再次连接
+	s1.Close()
+	time.Sleep(50 * time.Millisecond)
+	if admitted(t, server, sessions) == nil {
+		t.Fatal("session should be admitted after release")
+	}
+
+	server.SetMaxSessions(0)
+	server.SetMaxSessionsPerIP(2)
+	if admitted(t, server, sessions) != nil {
+		t.Fatal("max sessions per ip not work")
+	}
+	server.SetMaxSessionsPerIP(0)
+
+	if err = server.SetDenyList("127.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if admitted(t, server, sessions) != nil {
+		t.Fatal("deny list not work")
+	}
+	server.SetDenyList()
+
+	if err = server.SetAllowList("10.0.0.0/8", "192.168.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if admitted(t, server, sessions) != nil {
+		t.Fatal("allow list not work")
+	}
+	server.SetAllowList("127.0.0.1")
+	if admitted(t, server, sessions) == nil {
+		t.Fatal("allow list not work")
+	}
+
+	if err = server.SetAllowList("bad cidr"); err == nil {
+		t.Fatal("bad cidr should return error")
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	var sessions = make(chan *mynet.Session, 1)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", handshakeProtocol{serverTestProtocol()}, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		sessions <- s
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetMaxSessions(1)
+	server.SetHandshakeTimeout(50 * time.Millisecond)
+	go server.Serve()
+	defer server.Listener().Close()
+
+	// 不完成握手的连接超时后被关闭, 并且归还名额
+	idle, err := net.Dial("tcp", server.Listener().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("idle conn should be closed, got %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.Listener().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{1})
+	select {
+	case ses := <-sessions:
+		ses.Close()
+	case <-time.After(time.Second):
+		t.Fatal("session should be admitted after the idle conn timeout")
+	}
+}
@@ -1,6 +1,7 @@
 package mynet
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net"
@@ -25,7 +26,7 @@ type ClearSendChan interface {
 }
 
 //Listen 创建一个TCP监听的服务器
-//TODO 进行抽象, 实现gRPC, websocket等相关的实现
+//TODO 进行抽象, 实现gRPC等相关的实现. websocket 见 ListenWebSocket
 func Listen(network, addr string, protocol Protocol, sendChanSize int, handler Handler) (*Server, error) {
 	listener, err := net.Listen(network, addr)
 	if err != nil {
@@ -36,30 +37,70 @@ func Listen(network, addr string, protocol Protocol, sendChanSize int, handler H
 }
 
 //Dial 连接一个TCP接口的服务器
-func Dial(network, addr string, protocol Protocol, sendChanSize int) (*Session, error) {
+func Dial(network, addr string, protocol Protocol, sendChanSize int, opts ...SessionOption) (*Session, error) {
 	conn, err := net.Dial(network, addr)
 	if err != nil {
 		return nil, err
 	}
+	return newClientSession(conn, protocol, sendChanSize, opts)
+}
 
-	codec, err := protocol.NewCodec(conn)
+//DialTimeout 指定连接超时的连接
+func DialTimeout(network, addr string, timeout time.Duration, protocol Protocol, sendChanSize int, opts ...SessionOption) (*Session, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
 	if err != nil {
 		return nil, err
 	}
-	return NewSession(codec, sendChanSize), nil
+	return newClientSession(conn, protocol, sendChanSize, opts)
 }
 
-//DialTimeout 指定连接超时的连接
-func DialTimeout(network, addr string, timeout time.Duration, protocol Protocol, sendChanSize int) (*Session, error) {
-	conn, err := net.DialTimeout(network, addr, timeout)
+//DialContext 可以通过ctx取消的连接. ctx只作用于连接和创建Codec的阶段, 不影响返回的Session
+func DialContext(ctx context.Context, network, addr string, protocol Protocol, sendChanSize int, opts ...SessionOption) (*Session, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 有些Protocol会在NewCodec中进行握手, 这个阶段也需要响应ctx
+	var stop = make(chan struct{})
+	var stopped = make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	var rw = newSessionConn(conn)
+	codec, err := protocol.NewCodec(rw)
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, ctx.Err()
+	}
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	codec, err := protocol.NewCodec(conn)
+	conn.SetDeadline(time.Time{})
+	return newSession(nil, rw, protocol, codec, sendChanSize, opts), nil
+}
+
+//newClientSession 基于一个已经建立的连接创建Session
+func newClientSession(conn net.Conn, protocol Protocol, sendChanSize int, opts []SessionOption) (*Session, error) {
+	var rw = newSessionConn(conn)
+	codec, err := protocol.NewCodec(rw)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return NewSession(codec, sendChanSize), nil
+	return newSession(nil, rw, protocol, codec, sendChanSize, opts), nil
 }
 
 //Accept 接收一个连接
@@ -89,9 +130,10 @@ func Accept(listener net.Listener) (net.Conn, error) {
 				time.Sleep(tempDelay)
 				continue
 			}
-			if errors.Is(net.ErrClosed, err) {
+			if errors.Is(err, net.ErrClosed) {
 				return nil, io.EOF
 			}
+			return nil, err
 		}
 		if tempDelay != 0 {
 			tempDelay = 0
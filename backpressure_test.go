@@ -0,0 +1,140 @@
+package mynet_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+const backpressureQueue = 4
+
+//blockedSession 对端不读取数据, 发送队列很快就会满
+func blockedSession(t *testing.T, opts ...mynet.SessionOption) (*mynet.Session, net.Conn, *int32) {
+	var drops int32
+	opts = append(opts, mynet.WithDropCallback(func(s *mynet.Session, msg interface{}) {
+		atomic.AddInt32(&drops, 1)
+	}))
+	c1, c2 := net.Pipe()
+	codec, _ := serverTestProtocol().NewCodec(c1)
+	return mynet.NewSession(codec, backpressureQueue, opts...), c2, &drops
+}
+
+func TestBackpressureClose(t *testing.T) {
+	ses, peer, _ := blockedSession(t)
+	defer peer.Close()
+
+	var err error
+	for i := 0; i < backpressureQueue*2 && err == nil; i++ {
+		err = ses.Send(&serverMessage{Seq: i})
+	}
+	if err != mynet.ErrSessionBlocked || ses.Err() != mynet.ErrSessionBlocked {
+		t.Fatalf("expect session closed, got %v", err)
+	}
+}
+
+func TestBackpressureDropNewest(t *testing.T) {
+	ses, peer, drops := blockedSession(t, mynet.WithBackpressure(mynet.BackpressureDropNewest, 0))
+	defer ses.Close()
+	defer peer.Close()
+
+	const total = backpressureQueue * 4
+	var dropped int32
+	for i := 0; i < total; i++ {
+		switch err := ses.Send(&serverMessage{Seq: i}); err {
+		case nil:
+		case mynet.ErrMessageDropped:
+			dropped++
+		default:
+			t.Fatal(err)
+		}
+	}
+	// 发送协程最多取走一条消息, 丢弃的消息都返回了错误
+	if n := atomic.LoadInt32(drops); n < total-backpressureQueue-1 || n != dropped {
+		t.Fatalf("expect drops, got %v callbacks and %v errors", n, dropped)
+	}
+	if ses.IsClosed() {
+		t.Fatal("session should not be closed")
+	}
+	if stats := ses.Stats(); stats.QueueLen != backpressureQueue || stats.QueuePeak != backpressureQueue {
+		t.Fatalf("queue stats not match: %+v", stats)
+	}
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	ses, peer, drops := blockedSession(t, mynet.WithBackpressure(mynet.BackpressureDropOldest, 0))
+	defer ses.Close()
+
+	const total = backpressureQueue * 4
+	for i := 0; i < total; i++ {
+		if err := ses.Send(&serverMessage{Seq: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 最后发送的消息一定还在队列中
+	var receiver = mynet.NewSession(func() mynet.Codec {
+		codec, _ := serverTestProtocol().NewCodec(peer)
+		return codec
+	}(), 0)
+	defer receiver.Close()
+	var received int32
+	for {
+		msg, err := receiver.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		received++
+		if msg.(*serverMessage).Seq == total-1 {
+			break
+		}
+	}
+	if n := atomic.LoadInt32(drops); n+received != total {
+		t.Fatalf("drops %v + received %v != %v", n, received, total)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	ses, peer, _ := blockedSession(t, mynet.WithBackpressure(mynet.BackpressureBlock, 0))
+	defer peer.Close()
+
+	var result = make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			if err := ses.Send(&serverMessage{Seq: i}); err != nil {
+				result <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-result:
+		t.Fatalf("send should block, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 关闭Session可以唤醒阻塞的Send
+	ses.Close()
+	if err := <-result; err != mynet.ErrSessionClosed {
+		t.Fatalf("expect session closed, got %v", err)
+	}
+}
+
+func TestBackpressureBlockTimeout(t *testing.T) {
+	ses, peer, drops := blockedSession(t, mynet.WithBackpressure(mynet.BackpressureBlockTimeout, 20*time.Millisecond))
+	defer ses.Close()
+	defer peer.Close()
+
+	var err error
+	for i := 0; err == nil; i++ {
+		err = ses.Send(&serverMessage{Seq: i})
+	}
+	if err != mynet.ErrMessageDropped || ses.IsClosed() {
+		t.Fatalf("expect dropped without close, got %v", err)
+	}
+	if atomic.LoadInt32(drops) != 1 {
+		t.Fatalf("expect 1 drop, got %v", *drops)
+	}
+}
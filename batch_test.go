@@ -0,0 +1,125 @@
+package mynet_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+type countConn struct {
+	net.Conn
+	writes *int32
+}
+
+func (c countConn) Write(p []byte) (int, error) {
+	atomic.AddInt32(c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+type countListener struct {
+	net.Listener
+	writes int32
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countConn{Conn: conn, writes: &l.writes}, nil
+}
+
+//batchWrites 服务器收到一条消息后连续发送total条消息, 返回服务器写入连接的次数
+func batchWrites(t *testing.T, total int, opts ...mynet.SessionOption) int32 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter = &countListener{Listener: listener}
+	var protocol = serverTestProtocol()
+	var server = mynet.NewServer(counter, protocol, total, mynet.HandlerFunc(func(s *mynet.Session) {
+		if _, err := s.Receive(); err != nil {
+			return
+		}
+		for i := 0; i < total; i++ {
+			if err := s.Send(&serverMessage{Seq: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		s.Receive()
+	}))
+	server.SetSessionOptions(opts...)
+	go server.Serve()
+	defer listener.Close()
+
+	client, err := mynet.Dial("tcp", listener.Addr().String(), protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err = client.Send(&serverMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < total; i++ {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*serverMessage).Seq != i {
+			t.Fatalf("expect %v, got %v", i, msg)
+		}
+	}
+	return atomic.LoadInt32(&counter.writes)
+}
+
+func TestWriteCoalescingDelay(t *testing.T) {
+	const total = 100
+	// 等待足够长的时间, 所有消息合并成很少的几次写入
+	if writes := batchWrites(t, total, mynet.WithWriteCoalescing(50*time.Millisecond, 0)); writes > 5 {
+		t.Fatalf("expect coalesced writes, got %v", writes)
+	}
+}
+
+func TestWriteCoalescingSize(t *testing.T) {
+	const total = 100
+	// 大小阈值比一条消息还小, 每条消息单独写入
+	if writes := batchWrites(t, total, mynet.WithWriteCoalescing(50*time.Millisecond, 1)); writes != total {
+		t.Fatalf("expect %v writes, got %v", total, writes)
+	}
+}
+
+func TestWriteCoalescingWebSocket(t *testing.T) {
+	const total = 100
+	var protocol = serverTestProtocol()
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", nil, protocol, total, mynet.HandlerFunc(func(s *mynet.Session) {
+		for i := 0; i < total; i++ {
+			s.Send(&serverMessage{Seq: i})
+		}
+		s.Receive()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetSessionOptions(mynet.WithWriteCoalescing(20*time.Millisecond, 0))
+	go server.Serve()
+	defer server.Listener().Close()
+
+	client, err := mynet.DialWebSocket("ws://"+server.Listener().Addr().String()+"/", nil, protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < total; i++ {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*serverMessage).Seq != i {
+			t.Fatalf("expect %v, got %v", i, msg)
+		}
+	}
+}
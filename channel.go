@@ -47,7 +47,7 @@ func (c *Channel) Put(key KEY, session *Session) {
 	}
 
 	// 增加关闭的回调
-	session.AddCloseCallback(c, key, func() {
+	session.AddCloseCallback(c, key, func(error) {
 		c.Remove(key)
 	})
 	c.sessionMap[key] = session
@@ -82,6 +82,26 @@ func (c *Channel) FetchAndRemove(callback func(*Session)) {
 	}
 }
 
+//Broadcast 给Channel中所有的Session发送消息, 返回发送成功的数量
+//每个Protocol只编码一次, 参考 Encode
+func (c *Channel) Broadcast(msg interface{}) int {
+	c.mutex.RLock()
+	var sessions = make([]*Session, 0, len(c.sessionMap))
+	for _, ses := range c.sessionMap {
+		sessions = append(sessions, ses)
+	}
+	c.mutex.RUnlock()
+
+	var n int
+	var cache = newEncodeCache(msg)
+	for _, ses := range sessions {
+		if ses.Send(cache.message(ses)) == nil {
+			n++
+		}
+	}
+	return n
+}
+
 //Close 关闭Channel
 func (c *Channel) Close() {
 	c.mutex.Lock()
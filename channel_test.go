@@ -0,0 +1,147 @@
+package mynet_test
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+)
+
+//countProtocol 统计真正编码的次数
+type countProtocol struct {
+	mynet.Protocol
+	encodes int32
+}
+
+type countCodec struct {
+	mynet.Codec
+	p  *countProtocol
+	rw io.ReadWriter
+}
+
+//WritesEncoded countCodec自己处理 *mynet.Encoded
+func (p *countProtocol) WritesEncoded() bool {
+	return true
+}
+
+func (p *countProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
+	codec, err := p.Protocol.NewCodec(rw)
+	return &countCodec{Codec: codec, p: p, rw: rw}, err
+}
+
+func (c *countCodec) Send(msg interface{}) error {
+	if e, ok := msg.(*mynet.Encoded); ok && e.Protocol() == mynet.Protocol(c.p) {
+		_, err := c.rw.Write(e.Data)
+		return err
+	}
+	atomic.AddInt32(&c.p.encodes, 1)
+	return c.Codec.Send(msg)
+}
+
+func TestChannelBroadcast(t *testing.T) {
+	const total = 5
+	var protocol = &countProtocol{Protocol: serverTestProtocol()}
+	var channel = mynet.NewChannel()
+	var joined = make(chan struct{}, total)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		channel.Put(s.ID(), s)
+		joined <- struct{}{}
+		s.Receive()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	var clients []*mynet.Session
+	for i := 0; i < total; i++ {
+		client, err := mynet.Dial("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		clients = append(clients, client)
+		<-joined
+	}
+
+	if n := channel.Broadcast(&serverMessage{Seq: 100}); n != total {
+		t.Fatalf("expect broadcast to %v, got %v", total, n)
+	}
+	for _, client := range clients {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*serverMessage).Seq != 100 {
+			t.Fatalf("message not match: %v", msg)
+		}
+	}
+	if n := atomic.LoadInt32(&protocol.encodes); n != 1 {
+		t.Fatalf("expect encode once, got %v", n)
+	}
+}
+
+//plainProtocol 不认识 *mynet.Encoded 的Protocol
+type plainProtocol struct {
+	mynet.Protocol
+}
+
+type plainCodec struct {
+	mynet.Codec
+}
+
+func (p plainProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
+	codec, err := p.Protocol.NewCodec(rw)
+	return plainCodec{codec}, err
+}
+
+func (c plainCodec) Send(msg interface{}) error {
+	if _, ok := msg.(*mynet.Encoded); ok {
+		return errors.New("unexpected *mynet.Encoded")
+	}
+	return c.Codec.Send(msg)
+}
+
+func TestBroadcastPlainProtocol(t *testing.T) {
+	var joined = make(chan *mynet.Session, 1)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", plainProtocol{serverTestProtocol()}, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		joined <- s
+		s.Receive()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var ses = <-joined
+
+	// 没有实现 EncodedWriter 的Protocol收到原始的消息, 直接发送 *Encoded 也一样
+	if n := server.Manager().Broadcast(&serverMessage{Seq: 1}, nil); n != 1 {
+		t.Fatalf("broadcast to %v", n)
+	}
+	encoded, err := mynet.Encode(serverTestProtocol(), &serverMessage{Seq: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ses.Send(encoded); err != nil {
+		t.Fatal(err)
+	}
+	for seq := 1; seq <= 2; seq++ {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*serverMessage).Seq != seq {
+			t.Fatalf("message not match: %v", msg)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package mynet
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClientClosed       = errors.New("client closed")
+	ErrClientDisconnected = errors.New("client disconnected")
+	ErrClientBufferFull   = errors.New("client buffer full")
+	ErrClientGiveUp       = errors.New("client give up reconnecting")
+)
+
+//DialFunc 建立一个新的Session, 如 Dial, DialTLS 和 DialWebSocket 的封装
+type DialFunc func() (*Session, error)
+
+//ClientConfig 自动重连的配置, 零值的字段使用默认值
+type ClientConfig struct {
+	MinBackoff time.Duration // 第一次重连的等待时间, 默认100ms
+	MaxBackoff time.Duration // 重连等待时间的上限, 默认30s
+	Jitter     float64       // 等待时间随机减少的比例, 取值[0,1], 避免大量客户端同时重连
+	MaxRetries int           // 连续失败多少次后放弃, 0表示一直重连
+
+	// 断线期间发送的消息最多缓存多少条, 重连后按顺序发出
+	// 0表示不缓存, 断线期间的Send直接返回 ErrClientDisconnected
+	BufferSize int
+
+	// 每次连接成功后调用(包括第一次), 一般用来重新登录. 返回错误时关闭这个连接并重连
+	// 在缓存的消息发出之前调用, 可以直接使用参数中的Session收发消息
+	OnConnect func(s *Session) error
+}
+
+//Client 自动重连的客户端. 连接断开后按照指数退避重新连接, 对调用者屏蔽底层Session的更换
+//和Session一样, 连接断开是在收发消息时发现的, 需要有协程在执行 Client.Receive 或者开启心跳
+type Client struct {
+	dial   DialFunc
+	config ClientConfig
+
+	mutex   sync.Mutex
+	session *Session      // 当前可用的Session, 断线期间为nil
+	notify  chan struct{} // 连接状态变化时关闭并替换
+	pending []interface{} // 断线期间缓存的消息
+	err     error         // 客户端关闭的原因
+
+	closeFlag int32
+	closeChan chan struct{}
+}
+
+//NewClient 创建一个自动重连的客户端, 在后台建立连接后立即返回
+func NewClient(dial DialFunc, config *ClientConfig) *Client {
+	var c = &Client{
+		dial:      dial,
+		notify:    make(chan struct{}),
+		closeChan: make(chan struct{}),
+	}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.MinBackoff <= 0 {
+		c.config.MinBackoff = 100 * time.Millisecond
+	}
+	if c.config.MaxBackoff < c.config.MinBackoff {
+		c.config.MaxBackoff = 30 * time.Second
+		if c.config.MaxBackoff < c.config.MinBackoff {
+			c.config.MaxBackoff = c.config.MinBackoff
+		}
+	}
+	go c.loop()
+	return c
+}
+
+//DialClient 通过 Dial 连接服务器的自动重连客户端
+func DialClient(network, addr string, protocol Protocol, sendChanSize int, config *ClientConfig, opts ...SessionOption) *Client {
+	return NewClient(func() (*Session, error) {
+		return Dial(network, addr, protocol, sendChanSize, opts...)
+	}, config)
+}
+
+//Session 返回当前的Session, 断线期间返回nil
+func (c *Client) Session() *Session {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.session
+}
+
+//Send 发送一条消息. 断线期间按照配置缓存或者返回 ErrClientDisconnected
+func (c *Client) Send(msg interface{}) error {
+	for {
+		c.mutex.Lock()
+		if c.IsClosed() {
+			c.mutex.Unlock()
+			return c.closeErr()
+		}
+		var ses = c.session
+		if ses == nil {
+			defer c.mutex.Unlock()
+			if c.config.BufferSize <= 0 {
+				return ErrClientDisconnected
+			}
+			if len(c.pending) >= c.config.BufferSize {
+				return ErrClientBufferFull
+			}
+			c.pending = append(c.pending, msg)
+			return nil
+		}
+		c.mutex.Unlock()
+
+		err := ses.Send(msg)
+		if err == nil || !ses.IsClosed() {
+			return err
+		}
+		// 发送时连接断开了, 等重连协程更新状态后重新处理
+		c.waitChange(ses)
+	}
+}
+
+//Receive 接收一条消息. 断线期间阻塞到重连成功, 客户端关闭后返回错误
+func (c *Client) Receive() (interface{}, error) {
+	for {
+		c.mutex.Lock()
+		var ses = c.session
+		c.mutex.Unlock()
+		if c.IsClosed() {
+			return nil, c.closeErr()
+		}
+		if ses == nil {
+			c.waitChange(nil)
+			continue
+		}
+
+		msg, err := ses.Receive()
+		if err == nil {
+			return msg, nil
+		}
+		c.waitChange(ses)
+	}
+}
+
+//waitChange 等待当前的Session不再是ses
+func (c *Client) waitChange(ses *Session) {
+	for {
+		c.mutex.Lock()
+		var current, notify = c.session, c.notify
+		c.mutex.Unlock()
+		if current != ses {
+			return
+		}
+		select {
+		case <-notify:
+		case <-c.closeChan:
+			return
+		}
+	}
+}
+
+//IsClosed 客户端是否已经关闭
+func (c *Client) IsClosed() bool {
+	return atomic.LoadInt32(&c.closeFlag) == 1
+}
+
+//Close 关闭客户端和当前的连接, 缓存的消息会被丢弃
+func (c *Client) Close() error {
+	return c.close(ErrClientClosed)
+}
+
+func (c *Client) close(err error) error {
+	if !atomic.CompareAndSwapInt32(&c.closeFlag, 0, 1) {
+		return ErrClientClosed
+	}
+	c.mutex.Lock()
+	c.err = err
+	var ses = c.session
+	c.pending = nil
+	c.mutex.Unlock()
+
+	close(c.closeChan)
+	if ses != nil {
+		ses.Close()
+	}
+	return nil
+}
+
+func (c *Client) closeErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClientClosed
+}
+
+//setSession 更新当前的Session并通知等待者, 需要在外边持有mutex
+func (c *Client) setSession(ses *Session) {
+	c.session = ses
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+//loop 重连协程
+func (c *Client) loop() {
+	for {
+		ses := c.connect()
+		if ses == nil {
+			return
+		}
+
+		c.mutex.Lock()
+		if c.IsClosed() {
+			c.mutex.Unlock()
+			ses.Close()
+			return
+		}
+		// 按顺序发出缓存的消息, 发送失败的留到下一次连接
+		var sent int
+		for _, msg := range c.pending {
+			if ses.Send(msg) != nil {
+				break
+			}
+			sent++
+		}
+		c.pending = c.pending[sent:]
+		c.setSession(ses)
+		c.mutex.Unlock()
+
+		select {
+		case <-ses.Done():
+		case <-c.closeChan:
+			ses.Close()
+			return
+		}
+
+		c.mutex.Lock()
+		c.setSession(nil)
+		c.mutex.Unlock()
+	}
+}
+
+//connect 按照退避策略连接直到成功, 客户端关闭或者放弃重连时返回nil
+func (c *Client) connect() *Session {
+	for retry := 0; ; retry++ {
+		if retry > 0 {
+			if c.config.MaxRetries > 0 && retry >= c.config.MaxRetries {
+				c.close(ErrClientGiveUp)
+				return nil
+			}
+			select {
+			case <-time.After(c.backoff(retry)):
+			case <-c.closeChan:
+				return nil
+			}
+		}
+		if c.IsClosed() {
+			return nil
+		}
+
+		ses, err := c.dial()
+		if err != nil {
+			continue
+		}
+		if c.config.OnConnect != nil {
+			if err = c.config.OnConnect(ses); err != nil {
+				ses.Close()
+				continue
+			}
+		}
+		return ses
+	}
+}
+
+//backoff 第retry次重连前的等待时间
+func (c *Client) backoff(retry int) time.Duration {
+	var delay = c.config.MinBackoff
+	for i := 1; i < retry && delay < c.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.config.MaxBackoff {
+		delay = c.config.MaxBackoff
+	}
+	if c.config.Jitter > 0 {
+		delay -= time.Duration(float64(delay) * c.config.Jitter * rand.Float64())
+	}
+	return delay
+}
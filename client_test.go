@@ -0,0 +1,137 @@
+package mynet_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+//kickServer 回显消息, 收到Seq小于0的消息时断开连接
+func kickServer(t *testing.T) *mynet.Server {
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", serverTestProtocol(), 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		for {
+			msg, err := s.Receive()
+			if err != nil {
+				return
+			}
+			if msg.(*serverMessage).Seq < 0 {
+				s.Close()
+				return
+			}
+			if err = s.Send(msg); err != nil {
+				return
+			}
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	return server
+}
+
+func TestClientReconnect(t *testing.T) {
+	var server = kickServer(t)
+	defer server.Listener().Close()
+
+	var connects int32
+	var reconnecting = make(chan struct{})
+	var proceed = make(chan struct{})
+	var client = mynet.DialClient("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0, &mynet.ClientConfig{
+		MinBackoff: 10 * time.Millisecond,
+		Jitter:     0.5,
+		BufferSize: 10,
+		OnConnect: func(s *mynet.Session) error {
+			// 模拟登录, 第二次连接时等待测试缓存消息
+			if atomic.AddInt32(&connects, 1) == 2 {
+				close(reconnecting)
+				<-proceed
+			}
+			return nil
+		},
+	})
+	defer client.Close()
+
+	// 连接断开是在接收循环中发现的
+	var received = make(chan interface{}, 10)
+	go func() {
+		for {
+			msg, err := client.Receive()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- msg
+		}
+	}()
+	var expect = func(seq int) {
+		msg, ok := <-received
+		if !ok || msg.(*serverMessage).Seq != seq {
+			t.Fatalf("expect %v, got %v", seq, msg)
+		}
+	}
+
+	// 第一次连接完成之前的消息也会被缓存
+	if err := client.Send(&serverMessage{Seq: 1}); err != nil {
+		t.Fatal(err)
+	}
+	expect(1)
+
+	// 服务器断开连接, 断线期间的消息缓存起来, 重连后按顺序发出
+	if err := client.Send(&serverMessage{Seq: -1}); err != nil {
+		t.Fatal(err)
+	}
+	<-reconnecting
+	for i := 2; i < 5; i++ {
+		if err := client.Send(&serverMessage{Seq: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(proceed)
+	for i := 2; i < 5; i++ {
+		expect(i)
+	}
+}
+
+func TestClientReject(t *testing.T) {
+	var server = kickServer(t)
+
+	var client = mynet.DialClient("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0, &mynet.ClientConfig{
+		MinBackoff: 10 * time.Millisecond,
+	})
+	defer client.Close()
+
+	if err := client.Send(&serverMessage{Seq: 1}); err != nil && err != mynet.ErrClientDisconnected {
+		t.Fatal(err)
+	}
+	for client.Session() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	server.Listener().Close()
+	client.Send(&serverMessage{Seq: -1})
+	go client.Receive()
+
+	var deadline = time.Now().Add(time.Second)
+	for client.Send(&serverMessage{Seq: 2}) != mynet.ErrClientDisconnected {
+		if time.Now().After(deadline) {
+			t.Fatal("send should be rejected while disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientGiveUp(t *testing.T) {
+	var server = kickServer(t)
+	var addr = server.Listener().Addr().String()
+	server.Listener().Close()
+
+	var client = mynet.DialClient("tcp", addr, serverTestProtocol(), 0, &mynet.ClientConfig{
+		MinBackoff: time.Millisecond,
+		MaxRetries: 3,
+	})
+	if _, err := client.Receive(); err != mynet.ErrClientGiveUp {
+		t.Fatalf("expect give up, got %v", err)
+	}
+}
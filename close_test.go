@@ -0,0 +1,90 @@
+package mynet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+)
+
+type recordLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *recordLogger) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+func TestCloseReason(t *testing.T) {
+	var errKick = errors.New("kick")
+	sender, receiver := pipeSessions(t, 0)
+
+	var reason = make(chan error, 1)
+	receiver.AddCloseCallback(t, "reason", func(err error) {
+		reason <- err
+	})
+	if receiver.Err() != nil {
+		t.Fatal("open session should not have error")
+	}
+
+	sender.CloseWithError(errKick)
+	sender.Close()
+	if sender.Err() != errKick {
+		t.Fatalf("expect first reason, got %v", sender.Err())
+	}
+
+	// 对端关闭后读取失败
+	if _, err := receiver.Receive(); err == nil {
+		t.Fatal("receive should fail")
+	}
+	var opErr *mynet.OpError
+	if err := <-reason; !errors.As(err, &opErr) || opErr.Op != "read" || !errors.Is(err, io.EOF) {
+		t.Fatalf("expect read error, got %v", err)
+	}
+}
+
+func TestCloseReasonShutdown(t *testing.T) {
+	var sessions = make(chan *mynet.Session, 1)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", serverTestProtocol(), 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		sessions <- s
+		s.Receive()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logger = &recordLogger{}
+	server.SetSessionOptions(mynet.WithLogger(logger))
+	go server.Serve()
+
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), serverTestProtocol(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var ses = <-sessions
+	if err = server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ses.Err() != mynet.ErrServerClosed {
+		t.Fatalf("expect server closed, got %v", ses.Err())
+	}
+	var log = logger.String()
+	if !strings.Contains(log, "open") || !strings.Contains(log, mynet.ErrServerClosed.Error()) {
+		t.Fatalf("lifecycle not logged: %v", log)
+	}
+}
@@ -0,0 +1,220 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/ganyyy/mynet"
+)
+
+var ErrCompressData = errors.New("compressed data error")
+
+const (
+	compressFlag    = 1 << 31          // 包头的最高位, 表示消息体经过了压缩
+	compressMaxSize = compressFlag - 1 // 包头能表示的最大长度
+)
+
+//compressHead 发送时预留的包头空间
+var compressHead [4]byte
+
+//CompressStats 压缩的统计, 只统计发送的消息
+type CompressStats struct {
+	Frames     uint64 // 发送的消息数
+	Compressed uint64 // 其中压缩过的消息数
+	RawBytes   uint64 // 压缩前的字节数
+	WireBytes  uint64 // 压缩后实际发送的字节数, 不包括包头
+}
+
+//Ratio 压缩率, 压缩后和压缩前的字节数之比. 还没有发送过消息时返回1
+func (s CompressStats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 1
+	}
+	return float64(s.WireBytes) / float64(s.RawBytes)
+}
+
+//CompressProtocol 压缩包装, 对base编码后的消息进行压缩
+//每条消息的包头是4字节大端的长度, 最高位表示消息体是否经过了压缩. 超过threshold的消息才会压缩
+type CompressProtocol struct {
+	// 统计需要原子操作, 放在最前面保证对齐
+	frames     uint64
+	compressed uint64
+	rawBytes   uint64
+	wireBytes  uint64
+
+	base      mynet.Protocol
+	level     int  // flate的压缩等级
+	threshold int  // 超过这个长度才压缩
+	maxSize   uint // 解压前后的最大长度
+}
+
+//Compress 构建一个压缩的协议. level为 compress/flate 中的压缩等级, threshold为0时压缩所有的消息
+//maxSize同时限制收发的包长和解压后的长度, 为0时使用 DefaultMaxSize, 不会超过包头能表示的最大值
+func Compress(base mynet.Protocol, level, threshold int, maxSize uint) *CompressProtocol {
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxSize > compressMaxSize {
+		maxSize = compressMaxSize
+	}
+	return &CompressProtocol{
+		base:      base,
+		level:     level,
+		threshold: threshold,
+		maxSize:   maxSize,
+	}
+}
+
+//Stats 所有Codec发送消息的压缩统计
+func (c *CompressProtocol) Stats() CompressStats {
+	return CompressStats{
+		Frames:     atomic.LoadUint64(&c.frames),
+		Compressed: atomic.LoadUint64(&c.compressed),
+		RawBytes:   atomic.LoadUint64(&c.rawBytes),
+		WireBytes:  atomic.LoadUint64(&c.wireBytes),
+	}
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (c *CompressProtocol) WritesEncoded() bool {
+	return true
+}
+
+func (c *CompressProtocol) NewCodec(rw io.ReadWriter) (cc mynet.Codec, err error) {
+	var codec = &compressCodec{
+		CompressProtocol: c,
+		rw:               rw,
+	}
+	// 提前检查压缩等级, 避免在发送时才报错
+	if codec.writer, err = flate.NewWriter(&codec.zipBuf, c.level); err != nil {
+		return nil, err
+	}
+	codec.base, err = c.base.NewCodec(&codec.fixLenReadWriter)
+	return codec, err
+}
+
+type compressCodec struct {
+	*CompressProtocol
+	fixLenReadWriter
+
+	base    mynet.Codec
+	rw      io.ReadWriter
+	head    [4]byte // 读取包头用的缓冲区
+	bodyBuf []byte  // 读取消息用的缓冲区
+
+	writer *flate.Writer
+	zipBuf bytes.Buffer // 压缩后的消息, 包括包头
+	reader io.ReadCloser
+	rawBuf bytes.Buffer // 解压后的消息
+}
+
+//Receive 读取一条消息, 需要时先解压
+func (c *compressCodec) Receive() (interface{}, error) {
+	if _, err := io.ReadFull(c.rw, c.head[:]); err != nil {
+		return nil, err
+	}
+	var head = binary.BigEndian.Uint32(c.head[:])
+	var size = head &^ compressFlag
+	if uint(size) > c.maxSize {
+		return nil, ErrTooLargePacket
+	}
+	if cap(c.bodyBuf) < int(size) {
+		c.bodyBuf = make([]byte, size, size+128)
+	}
+	var buff = c.bodyBuf[:size]
+	if _, err := io.ReadFull(c.rw, buff); err != nil {
+		return nil, err
+	}
+
+	if head&compressFlag != 0 {
+		var err error
+		if buff, err = c.decompress(buff); err != nil {
+			return nil, err
+		}
+	}
+	c.recvBuf.Reset(buff)
+	return c.base.Receive()
+}
+
+//decompress 解压消息体, 解压后超过maxSize时返回 ErrTooLargePacket
+func (c *compressCodec) decompress(data []byte) ([]byte, error) {
+	if c.reader == nil {
+		c.reader = flate.NewReader(bytes.NewReader(data))
+	} else if err := c.reader.(flate.Resetter).Reset(bytes.NewReader(data), nil); err != nil {
+		return nil, err
+	}
+	c.rawBuf.Reset()
+	n, err := c.rawBuf.ReadFrom(io.LimitReader(c.reader, int64(c.maxSize)+1))
+	if err != nil {
+		return nil, ErrCompressData
+	}
+	if uint(n) > c.maxSize {
+		return nil, ErrTooLargePacket
+	}
+	return c.rawBuf.Bytes(), nil
+}
+
+//Send 编码一条消息, 超过阈值时压缩后发送
+func (c *compressCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(c.rw, c.CompressProtocol, msg)
+	if done {
+		return err
+	}
+
+	c.sendBuf.Reset()
+	c.sendBuf.Write(compressHead[:])
+	if err = c.base.Send(msg); err != nil {
+		return err
+	}
+	var buff = c.sendBuf.Bytes()
+	var raw = len(buff) - len(compressHead)
+	if uint(raw) > c.maxSize {
+		return ErrTooLargePacket
+	}
+	var head = uint32(raw)
+	if raw > c.threshold {
+		zipped, err := c.compress(buff[len(compressHead):])
+		if err != nil {
+			return err
+		}
+		// 压缩之后反而变大的消息(如已经压缩过的数据)按原样发送
+		if len(zipped) < len(buff) {
+			buff = zipped
+			head = uint32(len(buff)-len(compressHead)) | compressFlag
+			atomic.AddUint64(&c.compressed, 1)
+		}
+	}
+	var size = len(buff) - len(compressHead)
+	binary.BigEndian.PutUint32(buff, head)
+	atomic.AddUint64(&c.frames, 1)
+	atomic.AddUint64(&c.rawBytes, uint64(raw))
+	atomic.AddUint64(&c.wireBytes, uint64(size))
+	_, err = c.rw.Write(buff)
+	return err
+}
+
+//compress 压缩消息体, 返回的数据预留了包头的空间
+func (c *compressCodec) compress(data []byte) ([]byte, error) {
+	c.zipBuf.Reset()
+	c.zipBuf.Write(compressHead[:])
+	c.writer.Reset(&c.zipBuf)
+	if _, err := c.writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := c.writer.Close(); err != nil {
+		return nil, err
+	}
+	return c.zipBuf.Bytes(), nil
+}
+
+//Close 关闭解码器
+func (c *compressCodec) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
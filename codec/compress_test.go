@@ -0,0 +1,84 @@
+package codec_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/ganyyy/mynet/codec"
+)
+
+func TestCompress(t *testing.T) {
+	var protocol = codec.Compress(JsonTestProtocol(), flate.BestCompression, 128, 0)
+	var stream bytes.Buffer
+	c, err := protocol.NewCodec(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var small = &MyMessage1{Field1: "hello", Field2: 1}
+	var large = &MyMessage1{Field1: strings.Repeat("world", 1000), Field2: 2}
+	for _, msg := range []*MyMessage1{small, large} {
+		if err = c.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		// 只有超过阈值的消息设置了压缩标记
+		var head = binary.BigEndian.Uint32(stream.Bytes())
+		if compressed := head&(1<<31) != 0; compressed != (msg == large) {
+			t.Fatalf("compressed = %v, head = %x", compressed, head)
+		}
+		recv, err := c.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *recv.(*MyMessage1) != *msg {
+			t.Fatalf("receive %v", recv)
+		}
+	}
+
+	var stats = protocol.Stats()
+	if stats.Frames != 2 || stats.Compressed != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if ratio := stats.Ratio(); ratio <= 0 || ratio >= 0.1 {
+		t.Fatalf("ratio = %v", ratio)
+	}
+}
+
+func TestCompressLimit(t *testing.T) {
+	if _, err := codec.Compress(JsonTestProtocol(), 100, 0, 0).NewCodec(&bytes.Buffer{}); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+
+	// 压缩后很小的消息, 解压后超过上限时返回错误
+	var large = &MyMessage1{Field1: strings.Repeat("x", 4096)}
+	var stream bytes.Buffer
+	c, _ := codec.Compress(JsonTestProtocol(), flate.DefaultCompression, 0, 0).NewCodec(&stream)
+	c.Send(large)
+	c, _ = codec.Compress(JsonTestProtocol(), flate.DefaultCompression, 0, 1024).NewCodec(&stream)
+	if _, err := c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+	if err := c.Send(large); err != codec.ErrTooLargePacket {
+		t.Fatalf("send err = %v", err)
+	}
+
+	// 损坏的压缩数据
+	stream.Reset()
+	stream.Write([]byte{0x80, 0, 0, 3, 0xff, 0xff, 0xff})
+	if _, err := c.Receive(); err != codec.ErrCompressData {
+		t.Fatalf("receive err = %v", err)
+	}
+}
+
+func TestCompressDefaultMaxSize(t *testing.T) {
+	// 没有配置上限时使用 DefaultMaxSize, 不会按照对端的包头分配内存
+	var stream bytes.Buffer
+	binary.Write(&stream, binary.BigEndian, uint32(codec.DefaultMaxSize+1))
+	c, _ := codec.Compress(JsonTestProtocol(), flate.DefaultCompression, 0, 0).NewCodec(&stream)
+	if _, err := c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package codec
+
+import (
+	"io"
+
+	"github.com/ganyyy/mynet"
+)
+
+// 接口类型检查
+var (
+	_ mynet.EncodedWriter = (*JsonProtocol)(nil)
+	_ mynet.EncodedWriter = (*ProtoBufProtocol)(nil)
+	_ mynet.EncodedWriter = (*FixLenProtocol)(nil)
+	_ mynet.EncodedWriter = (*CompressProtocol)(nil)
+	_ mynet.EncodedWriter = (*VarintProtocol)(nil)
+	_ mynet.EncodedWriter = (*FrameProtocol)(nil)
+	_ mynet.EncodedWriter = (*PBMessageProtocol)(nil)
+)
+
+//writeEncoded 处理预先编码的消息. 同一个Protocol编码的消息直接写入, 返回done为true
+//其他Protocol编码的消息返回原始消息, 由Codec重新编码
+func writeEncoded(w io.Writer, p mynet.Protocol, msg interface{}) (raw interface{}, done bool, err error) {
+	e, ok := msg.(*mynet.Encoded)
+	if !ok {
+		return msg, false, nil
+	}
+	if e.Protocol() != p {
+		return e.Msg, false, nil
+	}
+	_, err = w.Write(e.Data)
+	return nil, true, err
+}
@@ -0,0 +1,96 @@
+package codec_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"mynet/proto/demo"
+	"reflect"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+func EncodedTest(t *testing.T, protocol, other mynet.Protocol, msg interface{}) {
+	encoded, err := mynet.Encode(protocol, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一个协议直接写入编码结果, 和正常编码的数据一致
+	var raw, direct bytes.Buffer
+	rawCodec, _ := protocol.NewCodec(&raw)
+	directCodec, _ := protocol.NewCodec(&direct)
+	if err = rawCodec.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err = directCodec.Send(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw.Bytes(), direct.Bytes()) || !bytes.Equal(raw.Bytes(), encoded.Data) {
+		t.Fatal("encoded data not match")
+	}
+	recv, err := directCodec.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recv, msg) && !isProtoEqual(recv, msg) {
+		t.Fatalf("message not match: %#v", recv)
+	}
+
+	// 其他协议按照原始消息重新编码
+	var stream bytes.Buffer
+	otherCodec, _ := other.NewCodec(&stream)
+	if err = otherCodec.Send(encoded); err != nil {
+		t.Fatal(err)
+	}
+	recv, err = otherCodec.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recv, msg) && !isProtoEqual(recv, msg) {
+		t.Fatalf("message not match: %#v", recv)
+	}
+}
+
+func isProtoEqual(a, b interface{}) bool {
+	pa, ok1 := a.(proto.Message)
+	pb, ok2 := b.(proto.Message)
+	return ok1 && ok2 && proto.Equal(pa, pb)
+}
+
+func TestJsonEncoded(t *testing.T) {
+	EncodedTest(t, JsonTestProtocol(), JsonTestProtocol(), &MyMessage1{Field1: "hello", Field2: 1})
+}
+
+func TestPBEncoded(t *testing.T) {
+	EncodedTest(t, PBTestProtocol(), PBTestProtocol(), &demo.Req{Str: "hello"})
+}
+
+func TestFixLenEncoded(t *testing.T) {
+	var base = JsonTestProtocol()
+	EncodedTest(t, codec.FixLen(base, 2, binary.BigEndian, 1024, 1024), codec.FixLen(base, 4, binary.LittleEndian, 1024, 1024), &MyMessage1{Field1: "hello", Field2: 1})
+}
+
+func TestCompressEncoded(t *testing.T) {
+	var base = JsonTestProtocol()
+	EncodedTest(t, codec.Compress(base, flate.BestSpeed, 0, 0), codec.Compress(base, flate.BestCompression, 1024, 0), &MyMessage1{Field1: "hello", Field2: 1})
+}
+
+func TestVarintEncoded(t *testing.T) {
+	var base = JsonTestProtocol()
+	EncodedTest(t, codec.Varint(base, 1024, 1024), codec.FixLen(base, 2, binary.BigEndian, 1024, 1024), &MyMessage1{Field1: "hello", Field2: 1})
+}
+
+func TestFrameEncoded(t *testing.T) {
+	var base = JsonTestProtocol()
+	var config = codec.FrameConfig{LengthOffset: 2, LengthSize: 4, StripBytes: 6, Magic: []byte{0xca, 0xfe}}
+	frame, err := codec.Frame(base, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := codec.Frame(base, config)
+	EncodedTest(t, frame, other, &MyMessage1{Field1: "hello", Field2: 1})
+}
@@ -0,0 +1,362 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/ganyyy/mynet"
+)
+
+var (
+	ErrHandshake  = errors.New("encrypt handshake failed")
+	ErrPublicKey  = errors.New("invalid public key")
+	ErrPrivateKey = errors.New("invalid private key")
+	ErrDecrypt    = errors.New("message authentication failed")
+)
+
+const (
+	encryptHeadSize = 4  // 包头是4字节大端的密文长度
+	encryptKeySize  = 32 // AES-256
+	encryptCounter  = 4  // nonce中计数器开始的位置, 前4字节固定为0
+	encryptMaxSize  = math.MaxInt32
+)
+
+//encryptHead 发送时预留的包头空间
+var encryptHead [encryptHeadSize]byte
+
+//EncryptConfig 加密协议的配置
+type EncryptConfig struct {
+	Server bool // 是否是服务器, 握手时客户端先发送公钥
+
+	// 服务器的静态私钥, 可选. 只在服务器上设置
+	PrivateKey []byte
+	// 客户端预先知道的服务器静态公钥, 可选. 设置后只能和持有对应私钥的服务器完成握手
+	ServerKey []byte
+
+	MaxSize uint // 单条消息明文的最大长度, 0表示 DefaultMaxSize
+}
+
+//EncryptProtocol 加密包装. 在 NewCodec 中进行ECDH(P-256)握手, 通过HKDF-SHA256为每个方向生成单独的AES-GCM密钥
+//每条消息的包头是4字节大端的密文长度, nonce是每个方向单独递增的计数器, 不在网络上传输
+//重放, 乱序和被篡改的消息都无法通过校验, Receive 返回 ErrDecrypt
+//
+//握手过程: 客户端发送临时公钥, 服务器回复临时公钥和一条空的加密消息, 客户端通过这条消息确认双方的密钥一致
+//配置了服务器静态密钥时, 静态密钥参与密钥的生成, 不持有私钥的中间人无法完成握手
+//
+//由于每个连接的密钥不同, 这个协议不能通过 mynet.Encode 预先编码, 也没有实现 mynet.EncodedWriter, 广播时每个Session单独编码和加密
+//
+//握手使用P-256而不是X25519: go.mod 要求兼容Go 1.16, 标准库的 crypto/ecdh 需要Go 1.20,
+//也不想为此引入 golang.org/x/crypto, 所以使用 crypto/elliptic. 升级Go版本之后可以换成 ecdh.X25519
+type EncryptProtocol struct {
+	base   mynet.Protocol
+	config EncryptConfig
+
+	curve     elliptic.Curve
+	staticKey []byte // 服务器的静态私钥
+	serverKey *point // 客户端知道的服务器静态公钥
+}
+
+type point struct {
+	x, y *big.Int
+}
+
+//GenerateEncryptKey 生成服务器的静态密钥对. private给服务器的 EncryptConfig.PrivateKey, public给客户端的 EncryptConfig.ServerKey
+func GenerateEncryptKey() (private, public []byte, err error) {
+	var curve = elliptic.P256()
+	private, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return private, elliptic.Marshal(curve, x, y), nil
+}
+
+//Encrypt 构建一个加密的协议, 密钥的格式错误时返回 ErrPrivateKey 或者 ErrPublicKey
+func Encrypt(base mynet.Protocol, config *EncryptConfig) (*EncryptProtocol, error) {
+	var p = &EncryptProtocol{
+		base:  base,
+		curve: elliptic.P256(),
+	}
+	if config != nil {
+		p.config = *config
+	}
+	if p.config.MaxSize == 0 {
+		p.config.MaxSize = DefaultMaxSize
+	}
+	if p.config.MaxSize > encryptMaxSize {
+		p.config.MaxSize = encryptMaxSize
+	}
+	if key := p.config.PrivateKey; key != nil {
+		var n = p.curve.Params().N
+		if len(key) != (n.BitLen()+7)/8 {
+			return nil, ErrPrivateKey
+		}
+		var k = new(big.Int).SetBytes(key)
+		if k.Sign() == 0 || k.Cmp(n) >= 0 {
+			return nil, ErrPrivateKey
+		}
+		p.staticKey = key
+	}
+	if key := p.config.ServerKey; key != nil {
+		pub, err := p.unmarshal(key)
+		if err != nil {
+			return nil, err
+		}
+		p.serverKey = pub
+	}
+	return p, nil
+}
+
+func (p *EncryptProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
+	var codec = &encryptCodec{
+		EncryptProtocol: p,
+		rw:              rw,
+	}
+	var err error
+	if p.config.Server {
+		err = codec.serverHandshake()
+	} else {
+		err = codec.clientHandshake()
+	}
+	if err != nil {
+		return nil, err
+	}
+	codec.base, err = p.base.NewCodec(&codec.fixLenReadWriter)
+	return codec, err
+}
+
+//unmarshal 解析并检查对方的公钥
+func (p *EncryptProtocol) unmarshal(data []byte) (*point, error) {
+	x, y := elliptic.Unmarshal(p.curve, data)
+	if x == nil {
+		return nil, ErrPublicKey
+	}
+	return &point{x: x, y: y}, nil
+}
+
+//sharedKey ECDH得到的共享密钥
+func (p *EncryptProtocol) sharedKey(private []byte, pub *point) []byte {
+	x, _ := p.curve.ScalarMult(pub.x, pub.y, private)
+	var shared = make([]byte, (p.curve.Params().BitSize+7)/8)
+	return x.FillBytes(shared)
+}
+
+type encryptCodec struct {
+	*EncryptProtocol
+	fixLenReadWriter
+
+	base mynet.Codec
+	rw   io.ReadWriter
+
+	sendAEAD  cipher.AEAD
+	sendNonce [12]byte
+	recvAEAD  cipher.AEAD
+	recvNonce [12]byte
+
+	head    [encryptHeadSize]byte // 读取包头用的缓冲区
+	bodyBuf []byte                // 读取消息用的缓冲区
+}
+
+func (c *encryptCodec) clientHandshake() error {
+	private, x, y, err := elliptic.GenerateKey(c.curve, rand.Reader)
+	if err != nil {
+		return err
+	}
+	var clientPub = elliptic.Marshal(c.curve, x, y)
+	if _, err = c.rw.Write(clientPub); err != nil {
+		return err
+	}
+
+	var serverPub = make([]byte, len(clientPub))
+	if _, err = io.ReadFull(c.rw, serverPub); err != nil {
+		return err
+	}
+	server, err := c.unmarshal(serverPub)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(clientPub, serverPub) {
+		// 自己的公钥被发了回来
+		return ErrHandshake
+	}
+	var ikm = c.sharedKey(private, server)
+	if c.serverKey != nil {
+		ikm = append(ikm, c.sharedKey(private, c.serverKey)...)
+	}
+	if err = c.setKeys(ikm, clientPub, serverPub, false); err != nil {
+		return err
+	}
+
+	// 服务器的确认消息是空的, 能解密说明双方的密钥一致
+	confirm, err := c.readFrame()
+	if err != nil || len(confirm) != 0 {
+		return ErrHandshake
+	}
+	return nil
+}
+
+func (c *encryptCodec) serverHandshake() error {
+	var size = len(elliptic.Marshal(c.curve, c.curve.Params().Gx, c.curve.Params().Gy))
+	var clientPub = make([]byte, size)
+	if _, err := io.ReadFull(c.rw, clientPub); err != nil {
+		return err
+	}
+	client, err := c.unmarshal(clientPub)
+	if err != nil {
+		return err
+	}
+
+	private, x, y, err := elliptic.GenerateKey(c.curve, rand.Reader)
+	if err != nil {
+		return err
+	}
+	var serverPub = elliptic.Marshal(c.curve, x, y)
+	var ikm = c.sharedKey(private, client)
+	if c.staticKey != nil {
+		ikm = append(ikm, c.sharedKey(c.staticKey, client)...)
+	}
+	if err = c.setKeys(ikm, clientPub, serverPub, true); err != nil {
+		return err
+	}
+
+	// 公钥和确认消息一次写入
+	var data = c.seal(append(serverPub, make([]byte, encryptHeadSize)...), len(serverPub))
+	_, err = c.rw.Write(data)
+	return err
+}
+
+//setKeys 根据共享密钥和双方的公钥生成两个方向的密钥
+func (c *encryptCodec) setKeys(ikm, clientPub, serverPub []byte, server bool) error {
+	var salt = append(append([]byte{}, clientPub...), serverPub...)
+	var prk = hkdfExtract(salt, ikm)
+	c2s, err := newGCM(hkdfExpand(prk, []byte("mynet client to server"), encryptKeySize))
+	if err != nil {
+		return err
+	}
+	s2c, err := newGCM(hkdfExpand(prk, []byte("mynet server to client"), encryptKeySize))
+	if err != nil {
+		return err
+	}
+	if server {
+		c.sendAEAD, c.recvAEAD = s2c, c2s
+	} else {
+		c.sendAEAD, c.recvAEAD = c2s, s2c
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//Receive 读取并解密一条消息
+func (c *encryptCodec) Receive() (interface{}, error) {
+	data, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	c.recvBuf.Reset(data)
+	return c.base.Receive()
+}
+
+//readFrame 读取一条消息, 返回解密后的数据
+func (c *encryptCodec) readFrame() ([]byte, error) {
+	if _, err := io.ReadFull(c.rw, c.head[:]); err != nil {
+		return nil, err
+	}
+	var size = binary.BigEndian.Uint32(c.head[:])
+	var overhead = uint32(c.recvAEAD.Overhead())
+	if size < overhead {
+		return nil, ErrDecrypt
+	}
+	if uint(size-overhead) > c.config.MaxSize {
+		return nil, ErrTooLargePacket
+	}
+	if cap(c.bodyBuf) < int(size) {
+		c.bodyBuf = make([]byte, size, size+128)
+	}
+	var buff = c.bodyBuf[:size]
+	if _, err := io.ReadFull(c.rw, buff); err != nil {
+		return nil, err
+	}
+	data, err := c.recvAEAD.Open(buff[:0], c.recvNonce[:], buff, c.head[:])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	incNonce(&c.recvNonce)
+	return data, nil
+}
+
+//Send 编码并加密一条消息
+func (c *encryptCodec) Send(msg interface{}) error {
+	c.sendBuf.Reset()
+	c.sendBuf.Write(encryptHead[:])
+	if err := c.base.Send(msg); err != nil {
+		return err
+	}
+	var buff = c.sendBuf.Bytes()
+	if uint(len(buff)-encryptHeadSize) > c.config.MaxSize {
+		return ErrTooLargePacket
+	}
+	_, err := c.rw.Write(c.seal(buff, 0))
+	return err
+}
+
+//seal 加密data[start+4:]中的数据, data[start:start+4]是预留的包头
+func (c *encryptCodec) seal(data []byte, start int) []byte {
+	var head = data[start : start+encryptHeadSize]
+	var plain = data[start+encryptHeadSize:]
+	binary.BigEndian.PutUint32(head, uint32(len(plain)+c.sendAEAD.Overhead()))
+	data = c.sendAEAD.Seal(data[:start+encryptHeadSize], c.sendNonce[:], plain, head)
+	incNonce(&c.sendNonce)
+	return data
+}
+
+//incNonce 递增nonce中的计数器
+func incNonce(nonce *[12]byte) {
+	var counter = binary.BigEndian.Uint64(nonce[encryptCounter:])
+	binary.BigEndian.PutUint64(nonce[encryptCounter:], counter+1)
+}
+
+//Close 关闭解码器
+func (c *encryptCodec) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//hkdfExtract HKDF-Extract(RFC 5869), 使用SHA-256
+func hkdfExtract(salt, ikm []byte) []byte {
+	var mac = hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+//hkdfExpand HKDF-Expand(RFC 5869), 使用SHA-256
+func hkdfExpand(prk, info []byte, length int) []byte {
+	var mac = hmac.New(sha256.New, prk)
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac.Reset()
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
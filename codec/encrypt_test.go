@@ -0,0 +1,159 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+)
+
+//recordConn 记录写入的数据
+type recordConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	c.written.Write(p)
+	return c.Conn.Write(p)
+}
+
+//encryptPair 在管道两端完成握手, 返回客户端和服务器的Codec
+func encryptPair(t *testing.T, client, server *codec.EncryptProtocol) (mynet.Codec, mynet.Codec, *recordConn, error) {
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+	var record = &recordConn{Conn: c1}
+	var done = make(chan error, 1)
+	var serverCodec mynet.Codec
+	go func() {
+		var err error
+		serverCodec, err = server.NewCodec(c2)
+		if err != nil {
+			c2.Close()
+		}
+		done <- err
+	}()
+	clientCodec, err := client.NewCodec(record)
+	if err != nil {
+		c1.Close()
+		<-done
+		return nil, nil, nil, err
+	}
+	if err = <-done; err != nil {
+		return nil, nil, nil, err
+	}
+	return clientCodec, serverCodec, record, nil
+}
+
+func newEncrypt(t *testing.T, config *codec.EncryptConfig) *codec.EncryptProtocol {
+	p, err := codec.Encrypt(JsonTestProtocol(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEncrypt(t *testing.T) {
+	client, server, record, err := encryptPair(t, newEncrypt(t, nil), newEncrypt(t, &codec.EncryptConfig{Server: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg = &MyMessage1{Field1: "secret", Field2: 1}
+	for i := 0; i < 3; i++ {
+		go client.Send(msg)
+		recv, err := server.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *recv.(*MyMessage1) != *msg {
+			t.Fatalf("receive %v", recv)
+		}
+		go server.Send(msg)
+		if recv, err = client.Receive(); err != nil || *recv.(*MyMessage1) != *msg {
+			t.Fatalf("receive %v, %v", recv, err)
+		}
+	}
+	if bytes.Contains(record.written.Bytes(), []byte("secret")) {
+		t.Fatal("plaintext on the wire")
+	}
+
+	if _, err = mynet.Encode(newEncrypt(t, nil), msg); err == nil {
+		t.Fatal("encrypt protocol should not be pre-encoded")
+	}
+}
+
+func TestEncryptReplay(t *testing.T) {
+	client, server, record, err := encryptPair(t, newEncrypt(t, nil), newEncrypt(t, &codec.EncryptConfig{Server: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var start = record.written.Len()
+	go client.Send(&MyMessage1{Field1: "hello"})
+	if _, err = server.Receive(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新发送同一条密文, 计数器已经变化, 无法通过校验
+	var frame = append([]byte{}, record.written.Bytes()[start:]...)
+	go record.Conn.Write(frame)
+	if _, err = server.Receive(); err != codec.ErrDecrypt {
+		t.Fatalf("replay err = %v", err)
+	}
+}
+
+func TestEncryptServerKey(t *testing.T) {
+	private, public, err := codec.GenerateEncryptKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server = newEncrypt(t, &codec.EncryptConfig{Server: true, PrivateKey: private})
+	if _, _, _, err = encryptPair(t, newEncrypt(t, &codec.EncryptConfig{ServerKey: public}), server); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务器没有对应的私钥, 客户端握手失败
+	_, other, _ := codec.GenerateEncryptKey()
+	_, _, _, err = encryptPair(t, newEncrypt(t, &codec.EncryptConfig{ServerKey: other}), server)
+	if err != codec.ErrHandshake {
+		t.Fatalf("handshake err = %v", err)
+	}
+
+	if _, err = codec.Encrypt(JsonTestProtocol(), &codec.EncryptConfig{ServerKey: []byte{4, 1, 2}}); err != codec.ErrPublicKey {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err = codec.Encrypt(JsonTestProtocol(), &codec.EncryptConfig{PrivateKey: make([]byte, 32)}); err != codec.ErrPrivateKey {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestEncryptMaxSize(t *testing.T) {
+	var config = &codec.EncryptConfig{MaxSize: 16}
+	client, _, _, err := encryptPair(t, newEncrypt(t, config), newEncrypt(t, &codec.EncryptConfig{Server: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Send(&MyMessage1{Field1: "too large for the limit"}); err != codec.ErrTooLargePacket {
+		t.Fatalf("send err = %v", err)
+	}
+}
+
+func TestEncryptDefaultMaxSize(t *testing.T) {
+	_, server, record, err := encryptPair(t, newEncrypt(t, nil), newEncrypt(t, &codec.EncryptConfig{Server: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 包头声明的长度超过默认的上限时, 不会读取和分配包体
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], codec.DefaultMaxSize+64)
+	go record.Conn.Write(head[:])
+	if _, err = server.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+}
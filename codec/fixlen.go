@@ -12,6 +12,10 @@ import (
 
 var ErrTooLargePacket = errors.New("too large packet")
 
+//DefaultMaxSize 包长上限的默认值, 长度上限配置为0时使用
+//接收时会按照对端发来的长度分配内存, 需要更大的消息时显式配置, 不要使用无限制的上限
+const DefaultMaxSize = 1 << 20
+
 type FixLenProtocol struct {
 	base        mynet.Protocol    // 编解码器
 	n           int               // 编/解码的位数
@@ -77,6 +81,11 @@ func FixLen(base mynet.Protocol, n int, byteOrder binary.ByteOrder, maxRecv, max
 	return proto
 }
 
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (f *FixLenProtocol) WritesEncoded() bool {
+	return true
+}
+
 func (f *FixLenProtocol) NewCodec(rw io.ReadWriter) (cc mynet.Codec, err error) {
 	var codec = &fixLenCodec{
 		rw:             rw,
@@ -137,10 +146,15 @@ func (f *fixLenCodec) Receive() (interface{}, error) {
 
 //Send 消息发送
 func (f *fixLenCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(f.rw, f.FixLenProtocol, msg)
+	if done {
+		return err
+	}
+
 	f.sendBuf.Reset()
 	// 预写入包头空间
 	f.sendBuf.Write(f.headBuf)
-	err := f.base.Send(msg)
+	err = f.base.Send(msg)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/ganyyy/mynet"
+)
+
+var ErrFrameKind = errors.New("unknown frame kind")
+
+// 控制帧的类型, 用来在消息之外附加RPC等额外的信息. JsonProtocol 和 ProtoBufProtocol 共用
+const (
+	frameRequest  = 1 // mynet.Request
+	frameResponse = 2 // mynet.Response
+	frameError    = 3 // mynet.RemoteError
+	framePing     = 4 // mynet.Ping, 没有消息体
+	framePong     = 5 // mynet.Pong, 没有消息体
+)
+
+//wrapFrame 根据帧的类型包装收到的消息
+func wrapFrame(kind uint8, seq uint32, body interface{}) (interface{}, error) {
+	switch kind {
+	case frameRequest:
+		return &mynet.Request{Seq: seq, Body: body}, nil
+	case frameResponse:
+		return &mynet.Response{Seq: seq, Body: body}, nil
+	}
+	return nil, ErrFrameKind
+}
+
+//heartbeatFrame 根据帧的类型生成心跳消息, 不是心跳帧时返回nil
+func heartbeatFrame(kind uint8, seq uint32) interface{} {
+	switch kind {
+	case framePing:
+		return &mynet.Ping{Seq: seq}
+	case framePong:
+		return &mynet.Pong{Seq: seq}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/ganyyy/mynet"
+)
+
+var (
+	ErrFrameConfig = errors.New("invalid frame config")
+	ErrFrameMagic  = errors.New("frame magic mismatch")
+	ErrFrameLength = errors.New("frame length error")
+)
+
+//FrameError 收到了格式错误的帧, Err是 ErrFrameMagic, ErrFrameLength 或者 ErrTooLargePacket
+type FrameError struct {
+	Err    error
+	Head   []byte // 收到的包头, 到长度字段结束为止
+	Length int64  // 根据长度字段计算出的整个帧的长度, 检查魔数失败时为0
+}
+
+func (e *FrameError) Error() string {
+	return e.Err.Error() + ": frame length " + strconv.FormatInt(e.Length, 10)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+//FrameConfig 帧的格式. 帧由 包头(LengthOffset字节) 长度字段(LengthSize字节) 消息体 组成
+//整个帧的长度 = LengthOffset + LengthSize + 长度字段的值 + Adjustment
+//如长度字段包括了整个包头时, Adjustment为 -(LengthOffset+LengthSize)
+type FrameConfig struct {
+	LengthOffset int              // 长度字段的偏移
+	LengthSize   int              // 长度字段的字节数, 可选1/2/3/4/8
+	ByteOrder    binary.ByteOrder // 长度字段的字节序, 默认大端
+	Adjustment   int              // 长度字段的值需要加上的修正
+	StripBytes   int              // 解码时去掉帧开头的多少字节, 剩余部分交给base解码
+
+	// 帧开头的魔数, 长度不能超过LengthOffset. 为空时不检查
+	Magic []byte
+	// 发送时长度字段前面的内容(如魔数和版本号), 长度需要等于LengthOffset. 为空时使用Magic, 不足的部分补0
+	Prefix []byte
+
+	MaxFrame uint // 整个帧的最大长度, 0表示 DefaultMaxSize
+}
+
+//FrameProtocol 可配置长度字段的协议, 用于对接包头格式不同的其他服务器
+//发送时总是写入完整的包头, base编码的数据作为消息体
+//所以只有StripBytes等于 LengthOffset+LengthSize 时, 对端的Receive和Send才是对称的
+type FrameProtocol struct {
+	base   mynet.Protocol
+	config FrameConfig
+	header int // 长度字段结束的位置
+}
+
+//Frame 构建一个可配置的帧协议, 配置错误时返回 ErrFrameConfig
+func Frame(base mynet.Protocol, config FrameConfig) (*FrameProtocol, error) {
+	switch config.LengthSize {
+	case 1, 2, 3, 4, 8:
+	default:
+		return nil, ErrFrameConfig
+	}
+	if config.LengthOffset < 0 || config.StripBytes < 0 || len(config.Magic) > config.LengthOffset {
+		return nil, ErrFrameConfig
+	}
+	if config.Prefix == nil {
+		config.Prefix = make([]byte, config.LengthOffset)
+		copy(config.Prefix, config.Magic)
+	}
+	if len(config.Prefix) != config.LengthOffset || !bytes.HasPrefix(config.Prefix, config.Magic) {
+		return nil, ErrFrameConfig
+	}
+	if config.ByteOrder == nil {
+		config.ByteOrder = binary.BigEndian
+	}
+	if config.MaxFrame == 0 {
+		config.MaxFrame = DefaultMaxSize
+	}
+	if config.MaxFrame > math.MaxInt32 {
+		config.MaxFrame = math.MaxInt32
+	}
+	return &FrameProtocol{
+		base:   base,
+		config: config,
+		header: config.LengthOffset + config.LengthSize,
+	}, nil
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (f *FrameProtocol) WritesEncoded() bool {
+	return true
+}
+
+func (f *FrameProtocol) NewCodec(rw io.ReadWriter) (cc mynet.Codec, err error) {
+	var codec = &frameCodec{
+		FrameProtocol: f,
+		rw:            rw,
+	}
+	codec.base, err = f.base.NewCodec(&codec.fixLenReadWriter)
+	return codec, err
+}
+
+//getLength 读取长度字段
+func (f *FrameProtocol) getLength(b []byte) uint64 {
+	var order = f.config.ByteOrder
+	switch f.config.LengthSize {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 3:
+		if order == binary.LittleEndian {
+			return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16
+		}
+		return uint64(b[2]) | uint64(b[1])<<8 | uint64(b[0])<<16
+	case 4:
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+//putLength 写入长度字段
+func (f *FrameProtocol) putLength(b []byte, v uint64) {
+	var order = f.config.ByteOrder
+	switch f.config.LengthSize {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		order.PutUint16(b, uint16(v))
+	case 3:
+		if order == binary.LittleEndian {
+			b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+		} else {
+			b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+		}
+	case 4:
+		order.PutUint32(b, uint32(v))
+	default:
+		order.PutUint64(b, v)
+	}
+}
+
+type frameCodec struct {
+	*FrameProtocol
+	fixLenReadWriter
+
+	base     mynet.Codec
+	rw       io.ReadWriter
+	frameBuf []byte // 读取消息用的缓冲区
+}
+
+//Receive 读取一帧, 检查魔数和长度后交给base解码
+func (f *frameCodec) Receive() (interface{}, error) {
+	if cap(f.frameBuf) < f.header {
+		f.frameBuf = make([]byte, f.header, f.header+128)
+	}
+	var head = f.frameBuf[:f.header]
+	if _, err := io.ReadFull(f.rw, head); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(head, f.config.Magic) {
+		return nil, f.frameError(ErrFrameMagic, head, 0)
+	}
+
+	var value = f.getLength(head[f.config.LengthOffset:])
+	if value > math.MaxInt32 {
+		// 超过了 MaxFrame 的上限, 避免后面的计算溢出
+		var length int64 = math.MaxInt64
+		if value < math.MaxInt64 {
+			length = int64(value)
+		}
+		return nil, f.frameError(ErrTooLargePacket, head, length)
+	}
+	var length = int64(value) + int64(f.config.Adjustment) + int64(f.header)
+	if length < int64(f.header) || length < int64(f.config.StripBytes) {
+		return nil, f.frameError(ErrFrameLength, head, length)
+	}
+	if length > int64(f.config.MaxFrame) {
+		return nil, f.frameError(ErrTooLargePacket, head, length)
+	}
+
+	if int64(cap(f.frameBuf)) < length {
+		var buf = make([]byte, length, length+128)
+		copy(buf, head)
+		f.frameBuf = buf
+	}
+	var frame = f.frameBuf[:length]
+	if _, err := io.ReadFull(f.rw, frame[f.header:]); err != nil {
+		return nil, err
+	}
+	f.recvBuf.Reset(frame[f.config.StripBytes:])
+	return f.base.Receive()
+}
+
+//frameError 复制包头, 接收缓冲区会被下一帧复用
+func (f *frameCodec) frameError(err error, head []byte, length int64) error {
+	return &FrameError{
+		Err:    err,
+		Head:   append([]byte{}, head...),
+		Length: length,
+	}
+}
+
+//Send 写入包头和base编码的消息体
+func (f *frameCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(f.rw, f.FrameProtocol, msg)
+	if done {
+		return err
+	}
+
+	f.sendBuf.Reset()
+	f.sendBuf.Write(f.config.Prefix)
+	f.sendBuf.Write(make([]byte, f.config.LengthSize))
+	if err = f.base.Send(msg); err != nil {
+		return err
+	}
+	var buff = f.sendBuf.Bytes()
+	if uint(len(buff)) > f.config.MaxFrame {
+		return ErrTooLargePacket
+	}
+	var value = int64(len(buff)) - int64(f.header) - int64(f.config.Adjustment)
+	if value < 0 || (f.config.LengthSize < 8 && value > 1<<(8*uint(f.config.LengthSize))-1) {
+		return ErrFrameLength
+	}
+	f.putLength(buff[f.config.LengthOffset:], uint64(value))
+	_, err = f.rw.Write(buff)
+	return err
+}
+
+//Close 关闭解码器
+func (f *frameCodec) Close() error {
+	if closer, ok := f.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ganyyy/mynet/codec"
+)
+
+//legacyFrame 魔数"GS" 版本号1 2字节长度, 长度包括整个5字节的包头
+func legacyFrame(t *testing.T) *codec.FrameProtocol {
+	protocol, err := codec.Frame(JsonTestProtocol(), codec.FrameConfig{
+		LengthOffset: 3,
+		LengthSize:   2,
+		Adjustment:   -5,
+		StripBytes:   5,
+		Magic:        []byte("GS"),
+		Prefix:       []byte("GS\x01"),
+		MaxFrame:     1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return protocol
+}
+
+func TestFrame(t *testing.T) {
+	var stream bytes.Buffer
+	c, _ := legacyFrame(t).NewCodec(&stream)
+	var msg = &MyMessage1{Field1: "hello", Field2: 1}
+	if err := c.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	var data = stream.Bytes()
+	if !bytes.HasPrefix(data, []byte("GS\x01")) || int(binary.BigEndian.Uint16(data[3:])) != len(data) {
+		t.Fatalf("frame head % x", data[:5])
+	}
+	recv, err := c.Receive()
+	if err != nil || *recv.(*MyMessage1) != *msg {
+		t.Fatalf("receive %v, %v", recv, err)
+	}
+
+	// 3字节小端的长度字段, 没有魔数
+	protocol, err := codec.Frame(JsonTestProtocol(), codec.FrameConfig{
+		LengthSize: 3,
+		ByteOrder:  binary.LittleEndian,
+		StripBytes: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	JsonTest(t, protocol)
+}
+
+func TestFrameMalformed(t *testing.T) {
+	var cases = []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte("XS\x01\x00\x10"), codec.ErrFrameMagic},
+		{[]byte("GS\x01\x00\x04"), codec.ErrFrameLength},
+		{[]byte("GS\x01\x10\x00"), codec.ErrTooLargePacket},
+	}
+	for _, c := range cases {
+		var stream = bytes.NewBuffer(c.data)
+		fc, _ := legacyFrame(t).NewCodec(stream)
+		_, err := fc.Receive()
+		var frameErr *codec.FrameError
+		if !errors.Is(err, c.err) || !errors.As(err, &frameErr) || !bytes.Equal(frameErr.Head, c.data) {
+			t.Fatalf("% x: err = %v", c.data, err)
+		}
+	}
+}
+
+func TestFrameConfig(t *testing.T) {
+	var configs = []codec.FrameConfig{
+		{LengthSize: 5},
+		{LengthOffset: 1, LengthSize: 2, Magic: []byte("GS")},
+		{LengthOffset: 2, LengthSize: 2, Magic: []byte("GS"), Prefix: []byte("XS")},
+		{LengthSize: 2, StripBytes: -1},
+	}
+	for _, config := range configs {
+		if _, err := codec.Frame(JsonTestProtocol(), config); err != codec.ErrFrameConfig {
+			t.Fatalf("%+v: err = %v", config, err)
+		}
+	}
+
+	// 长度字段放不下消息
+	protocol, _ := codec.Frame(JsonTestProtocol(), codec.FrameConfig{LengthSize: 1, StripBytes: 1})
+	c, _ := protocol.NewCodec(&bytes.Buffer{})
+	if err := c.Send(&MyMessage1{Field1: string(make([]byte, 300))}); err != codec.ErrFrameLength {
+		t.Fatalf("send err = %v", err)
+	}
+}
+
+func TestFrameDefaultMaxFrame(t *testing.T) {
+	protocol, err := codec.Frame(JsonTestProtocol(), codec.FrameConfig{LengthSize: 4, StripBytes: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], codec.DefaultMaxSize+1)
+	c, _ := protocol.NewCodec(bytes.NewBuffer(head[:]))
+	if _, err = c.Receive(); !errors.Is(err, codec.ErrTooLargePacket) {
+		t.Fatalf("receive err = %v", err)
+	}
+}
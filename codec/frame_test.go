@@ -0,0 +1,115 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mynet/proto/demo"
+	"reflect"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func FrameTest(t *testing.T, protocol mynet.Protocol, body interface{}, equal func(a, b interface{}) bool) {
+	var stream bytes.Buffer
+	codec, _ := protocol.NewCodec(&stream)
+
+	var msgs = []interface{}{
+		&mynet.Request{Seq: 1, Body: body},
+		&mynet.Response{Seq: 2, Body: body},
+		&mynet.RemoteError{Seq: 3, Code: 404, Message: "not found"},
+		&mynet.Ping{Seq: 4},
+		&mynet.Pong{Seq: 5},
+		body,
+	}
+	for _, msg := range msgs {
+		if err := codec.Send(msg); err != nil {
+			t.Fatalf("send %#v error:%v", msg, err)
+		}
+	}
+
+	for _, msg := range msgs {
+		recv, err := codec.Receive()
+		if err != nil {
+			t.Fatalf("receive %#v error:%v", msg, err)
+		}
+		switch m := msg.(type) {
+		case *mynet.Request:
+			r, ok := recv.(*mynet.Request)
+			if !ok || r.Seq != m.Seq || !equal(r.Body, m.Body) {
+				t.Fatalf("request not match: %#v", recv)
+			}
+		case *mynet.Response:
+			r, ok := recv.(*mynet.Response)
+			if !ok || r.Seq != m.Seq || !equal(r.Body, m.Body) {
+				t.Fatalf("response not match: %#v", recv)
+			}
+		case *mynet.RemoteError, *mynet.Ping, *mynet.Pong:
+			if !reflect.DeepEqual(recv, m) {
+				t.Fatalf("frame not match: %#v", recv)
+			}
+		default:
+			if !equal(recv, m) {
+				t.Fatalf("message not match: %#v", recv)
+			}
+		}
+	}
+}
+
+func TestJsonFrame(t *testing.T) {
+	FrameTest(t, JsonTestProtocol(), &MyMessage1{Field1: "123", Field2: 456}, func(a, b interface{}) bool {
+		return *a.(*MyMessage1) == *b.(*MyMessage1)
+	})
+}
+
+func pbEqual(a, b interface{}) bool {
+	return proto.Equal(a.(proto.Message), b.(proto.Message))
+}
+
+func TestPBFrame(t *testing.T) {
+	var pb = codec.PBProtocol(codec.PBFrames(0))
+	pb.Register(1, &demo.Req{})
+	FrameTest(t, pb, &demo.Req{Str: "hello"}, pbEqual)
+
+	// 控制帧的seq使用包头的字节序
+	pb = codec.PBProtocol(codec.PBFrames(0xFFFF), codec.PBByteOrder(binary.LittleEndian))
+	pb.Register(1, &demo.Req{})
+	FrameTest(t, pb, &demo.Req{Str: "hello"}, pbEqual)
+	var stream bytes.Buffer
+	c, _ := pb.NewCodec(&stream)
+	c.Send(&mynet.Ping{Seq: 1})
+	if !bytes.Equal(stream.Bytes(), []byte{5, 0, 0xFF, 0xFF, 4, 1, 0, 0, 0}) {
+		t.Fatalf("ping frame % x", stream.Bytes())
+	}
+}
+
+func TestPBFrameOptIn(t *testing.T) {
+	// 默认不开启控制帧, 0也是可以注册的ID
+	var pb = codec.PBProtocol()
+	if err := pb.Register(0, &emptypb.Empty{}); err != nil {
+		t.Fatalf("register err = %v", err)
+	}
+	var stream bytes.Buffer
+	c, _ := pb.NewCodec(&stream)
+	if err := c.Send(&mynet.Ping{Seq: 1}); err != codec.ErrMessageType {
+		t.Fatalf("send ping err = %v", err)
+	}
+	if err := c.Send(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := c.Receive(); err != nil || !pbEqual(msg, &emptypb.Empty{}) {
+		t.Fatalf("receive %v, %v", msg, err)
+	}
+
+	// 开启之后控制帧的ID是保留的
+	pb = codec.PBProtocol(codec.PBFrames(7))
+	if err := pb.Register(7, &emptypb.Empty{}); err != codec.ErrReservedID {
+		t.Fatalf("register err = %v", err)
+	}
+	if _, err := codec.NewPBProtocol(codec.PBIDSize(1), codec.PBFrames(256)); err != codec.ErrPBOption {
+		t.Fatalf("frame id err = %v", err)
+	}
+}
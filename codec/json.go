@@ -2,15 +2,48 @@ package codec
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"reflect"
+	"strconv"
 
 	"github.com/ganyyy/mynet"
 )
 
+var ErrUnknownMessage = errors.New("unknown message")
+
+//UnknownMessageError 严格模式下收到没有注册的消息, errors.Is(err, ErrUnknownMessage) 为true
+type UnknownMessageError struct {
+	Head string
+}
+
+func (e *UnknownMessageError) Error() string {
+	return "unknown message: " + strconv.Quote(e.Head)
+}
+
+func (e *UnknownMessageError) Is(target error) bool {
+	return target == ErrUnknownMessage
+}
+
+//UnknownMode 收到没有注册的消息时的处理方式
+type UnknownMode int
+
+const (
+	UnknownStrict  UnknownMode = iota // 返回 *UnknownMessageError, 默认的方式
+	UnknownLenient                    // 返回 *RawMessage, 保留原始的消息体
+	UnknownMap                        // 消息体解码成 map[string]interface{}
+)
+
+//RawMessage 宽松模式下没有注册的消息. 发送时原样写出, 可以用来转发
+type RawMessage struct {
+	Head string
+	Body json.RawMessage
+}
+
 type JsonProtocol struct {
 	strToType map[string]reflect.Type
 	typeToStr map[reflect.Type]string
+	unknown   UnknownMode
 }
 
 func Json() *JsonProtocol {
@@ -39,9 +72,20 @@ func (j *JsonProtocol) RegisterNmae(name string, t interface{}) {
 	j.strToType[name] = rt
 }
 
+//SetUnknownMode 设置收到没有注册的消息时的处理方式, 需要在创建Codec之前设置
+func (j *JsonProtocol) SetUnknownMode(mode UnknownMode) {
+	j.unknown = mode
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (j *JsonProtocol) WritesEncoded() bool {
+	return true
+}
+
 func (j *JsonProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
 	var codec = &jsonCodec{
 		p:      j,
+		w:      rw,
 		encode: json.NewEncoder(rw),
 		decode: json.NewDecoder(rw),
 	}
@@ -53,6 +97,7 @@ func (j *JsonProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
 type jsonCodec struct {
 	p      *JsonProtocol
 	closer io.Closer
+	w      io.Writer
 	encode *json.Encoder
 	decode *json.Decoder
 }
@@ -60,11 +105,21 @@ type jsonCodec struct {
 type jsonIn struct {
 	Head string
 	Body *json.RawMessage
+	Kind uint8  `json:",omitempty"` // 控制帧的类型, 普通消息为0
+	Seq  uint32 `json:",omitempty"` // RPC的序号
 }
 
 type jsonOut struct {
 	Head string
 	Body interface{}
+	Kind uint8  `json:",omitempty"`
+	Seq  uint32 `json:",omitempty"`
+}
+
+//jsonError 错误帧的Body
+type jsonError struct {
+	Code    int32
+	Message string
 }
 
 func (j *jsonCodec) Receive() (interface{}, error) {
@@ -74,23 +129,94 @@ func (j *jsonCodec) Receive() (interface{}, error) {
 		return nil, err
 	}
 
-	var body interface{}
-	if in.Head != "" {
-		if t, exist := j.p.strToType[in.Head]; exist {
-			body = reflect.New(t).Interface()
+	if msg := heartbeatFrame(in.Kind, in.Seq); msg != nil {
+		return msg, nil
+	}
+	if in.Kind == frameError {
+		var e jsonError
+		if in.Body != nil {
+			if err = json.Unmarshal(*in.Body, &e); err != nil {
+				return nil, err
+			}
 		}
+		return &mynet.RemoteError{Seq: in.Seq, Code: e.Code, Message: e.Message}, nil
 	}
-	err = json.Unmarshal(*in.Body, body)
+
+	body, err := j.decodeBody(&in)
 	if err != nil {
 		return nil, err
 	}
+	if in.Kind != 0 {
+		return wrapFrame(in.Kind, in.Seq, body)
+	}
 	return body, nil
 }
 
+//decodeBody 按照Head解码消息体, 没有Body或者Body为null时返回零值的消息
+func (j *jsonCodec) decodeBody(in *jsonIn) (interface{}, error) {
+	var data json.RawMessage
+	if in.Body != nil {
+		data = *in.Body
+	}
+	var empty = len(data) == 0 || string(data) == "null"
+
+	if t, exist := j.p.strToType[in.Head]; exist {
+		var body = reflect.New(t).Interface()
+		if empty {
+			return body, nil
+		}
+		return body, json.Unmarshal(data, body)
+	}
+
+	switch j.p.unknown {
+	case UnknownLenient:
+		return &RawMessage{Head: in.Head, Body: data}, nil
+	case UnknownMap:
+		var body map[string]interface{}
+		if empty {
+			return body, nil
+		}
+		return body, json.Unmarshal(data, &body)
+	default:
+		return nil, &UnknownMessageError{Head: in.Head}
+	}
+}
+
 func (j *jsonCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(j.w, j.p, msg)
+	if done {
+		return err
+	}
+
 	var out jsonOut
+	switch m := msg.(type) {
+	case *mynet.Request:
+		out.Kind, out.Seq, msg = frameRequest, m.Seq, m.Body
+	case *mynet.Response:
+		out.Kind, out.Seq, msg = frameResponse, m.Seq, m.Body
+	case *mynet.RemoteError:
+		out.Kind, out.Seq = frameError, m.Seq
+		out.Body = jsonError{Code: m.Code, Message: m.Message}
+		return j.encode.Encode(out)
+	case *mynet.Ping:
+		out.Kind, out.Seq = framePing, m.Seq
+		return j.encode.Encode(out)
+	case *mynet.Pong:
+		out.Kind, out.Seq = framePong, m.Seq
+		return j.encode.Encode(out)
+	}
+
+	if raw, ok := msg.(*RawMessage); ok {
+		// 宽松模式收到的消息原样转发
+		out.Head = raw.Head
+		if len(raw.Body) > 0 {
+			out.Body = raw.Body
+		}
+		return j.encode.Encode(out)
+	}
+
 	var t = reflect.TypeOf(msg)
-	if t.Kind() == reflect.Ptr {
+	if t != nil && t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 
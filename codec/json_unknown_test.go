@@ -0,0 +1,108 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+)
+
+func receiveRaw(t *testing.T, protocol mynet.Protocol, data string) (interface{}, error) {
+	codec, err := protocol.NewCodec(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec.Receive()
+}
+
+func unknownProtocol(mode codec.UnknownMode) *codec.JsonProtocol {
+	var protocol = JsonTestProtocol()
+	protocol.SetUnknownMode(mode)
+	return protocol
+}
+
+func TestJsonUnknownStrict(t *testing.T) {
+	var protocol = unknownProtocol(codec.UnknownStrict)
+	_, err := receiveRaw(t, protocol, `{"Head":"other","Body":{"A":1}}`)
+	var unknown *codec.UnknownMessageError
+	if !errors.Is(err, codec.ErrUnknownMessage) || !errors.As(err, &unknown) || unknown.Head != "other" {
+		t.Fatalf("expect unknown message, got %v", err)
+	}
+	// 没有Head的消息同样是未知的
+	if _, err = receiveRaw(t, protocol, `{"Body":{"A":1}}`); !errors.Is(err, codec.ErrUnknownMessage) {
+		t.Fatalf("expect unknown message, got %v", err)
+	}
+}
+
+func TestJsonUnknownLenient(t *testing.T) {
+	var protocol = unknownProtocol(codec.UnknownLenient)
+	msg, err := receiveRaw(t, protocol, `{"Head":"other","Body":{"A":1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := msg.(*codec.RawMessage)
+	if !ok || raw.Head != "other" || string(raw.Body) != `{"A":1}` {
+		t.Fatalf("raw message not match: %#v", msg)
+	}
+
+	// 原样转发
+	var stream safeBuffer
+	c, _ := protocol.NewCodec(&stream)
+	if err = c.Send(raw); err != nil {
+		t.Fatal(err)
+	}
+	if recv, err := c.Receive(); err != nil || !reflect.DeepEqual(recv, raw) {
+		t.Fatalf("forward not match: %#v %v", recv, err)
+	}
+}
+
+func TestJsonUnknownMap(t *testing.T) {
+	var protocol = unknownProtocol(codec.UnknownMap)
+	msg, err := receiveRaw(t, protocol, `{"Head":"other","Body":{"A":1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg, map[string]interface{}{"A": float64(1)}) {
+		t.Fatalf("map not match: %#v", msg)
+	}
+	if _, err = receiveRaw(t, protocol, `{"Head":"other","Body":[1,2]}`); err == nil {
+		t.Fatal("array body should fail in map mode")
+	}
+}
+
+func TestJsonMalformed(t *testing.T) {
+	var name = reflect.TypeOf(MyMessage1{}).PkgPath() + "/MyMessage1"
+	for _, mode := range []codec.UnknownMode{codec.UnknownStrict, codec.UnknownLenient, codec.UnknownMap} {
+		var protocol = unknownProtocol(mode)
+
+		// 注册过的消息没有Body或者Body为null时返回零值
+		for _, data := range []string{`{"Head":"` + name + `"}`, `{"Head":"` + name + `","Body":null}`} {
+			msg, err := receiveRaw(t, protocol, data)
+			if err != nil || *msg.(*MyMessage1) != (MyMessage1{}) {
+				t.Fatalf("mode %v: empty body not match: %#v %v", mode, msg, err)
+			}
+		}
+
+		// 类型不匹配
+		if _, err := receiveRaw(t, protocol, `{"Head":"`+name+`","Body":"text"}`); err == nil {
+			t.Fatalf("mode %v: mismatched body should fail", mode)
+		}
+		// 不完整的JSON
+		var syntax *json.SyntaxError
+		if _, err := receiveRaw(t, protocol, `{"Head":"`+name+`","Body":{]}`); !errors.As(err, &syntax) {
+			t.Fatalf("mode %v: expect syntax error, got %v", mode, err)
+		}
+		// 信封不是对象
+		if _, err := receiveRaw(t, protocol, `[1,2,3]`); err == nil {
+			t.Fatalf("mode %v: array envelope should fail", mode)
+		}
+		// 截断的数据
+		if _, err := receiveRaw(t, protocol, `{"Head":"`+name+`","Bo`); err == nil {
+			t.Fatalf("mode %v: truncated envelope should fail, got %v", mode, err)
+		}
+	}
+}
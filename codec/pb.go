@@ -17,22 +17,120 @@ var (
 	ErrReceiveID   = errors.New("receive msg id error")
 	ErrPackageHead = errors.New("package head error")
 	ErrMessageLen  = errors.New("package message len error")
+	ErrReservedID  = errors.New("message id is reserved")
+	ErrIDOverflow  = errors.New("message id overflows the id field")
+	ErrPBOption    = errors.New("invalid pb protocol option")
 )
 
 //ProtoBufProtocol proto 对应的编码
+//包头是 长度+ID, 默认都是2字节大端, 可以通过 PBOption 修改. RPC和心跳需要通过 PBFrames 开启
 type ProtoBufProtocol struct {
-	idToProto map[uint16]protoreflect.MessageType // ID到类型的映射
-	protoToId map[protoreflect.MessageType]uint16 // 类型到ID的映射
+	idToProto map[uint32]protoreflect.MessageType // ID到类型的映射
+	protoToId map[protoreflect.MessageType]uint32 // 类型到ID的映射
+
+	lenSize   int              // 长度字段的字节数
+	idSize    int              // ID字段的字节数
+	byteOrder binary.ByteOrder // 包头的字节序
+	maxSize   int              // 消息体的最大长度
+	frames    bool             // 是否开启控制帧
+	frameID   uint32           // 控制帧使用的消息ID
+}
+
+//PBOption ProtoBufProtocol 的可选配置, 收发两端需要使用相同的配置
+type PBOption func(*ProtoBufProtocol)
+
+//PBLenSize 长度字段的字节数, 可选1/2/4
+func PBLenSize(n int) PBOption {
+	return func(p *ProtoBufProtocol) {
+		p.lenSize = n
+	}
+}
+
+//PBIDSize ID字段的字节数, 可选1/2/4. 控制帧中附带的消息ID也使用这个长度
+func PBIDSize(n int) PBOption {
+	return func(p *ProtoBufProtocol) {
+		p.idSize = n
+	}
+}
+
+//PBByteOrder 包头的字节序, 默认大端
+func PBByteOrder(order binary.ByteOrder) PBOption {
+	return func(p *ProtoBufProtocol) {
+		p.byteOrder = order
+	}
 }
 
-func PBProtocol() *ProtoBufProtocol {
-	return &ProtoBufProtocol{
-		idToProto: map[uint16]protoreflect.MessageType{},
-		protoToId: map[protoreflect.MessageType]uint16{},
+//PBMaxSize 消息体的最大长度, 超过时收发都返回 ErrTooLargePacket
+//默认为 DefaultMaxSize, 不会超过长度字段能表示的最大值
+func PBMaxSize(size int) PBOption {
+	return func(p *ProtoBufProtocol) {
+		p.maxSize = size
 	}
 }
 
-func (p *ProtoBufProtocol) Register(id uint16, t proto.Message) error {
+//PBFrames 开启RPC和心跳的控制帧(mynet.Request/Response/RemoteError/Ping/Pong), 控制帧使用消息ID id
+//开启后id是保留的ID, 不能再注册消息. 默认不开启, 发送控制帧返回 ErrMessageType, 所有的ID都可以注册
+//控制帧的格式见 pbCodec.decodeFrame, 收发两端都需要开启并且使用相同的id
+func PBFrames(id uint32) PBOption {
+	return func(p *ProtoBufProtocol) {
+		p.frames = true
+		p.frameID = id
+	}
+}
+
+//PBProtocol 和 NewPBProtocol 相同, 配置错误时panic, 用于固定的配置
+func PBProtocol(opts ...PBOption) *ProtoBufProtocol {
+	p, err := NewPBProtocol(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+//NewPBProtocol 构建protobuf协议, 长度或者ID字段的字节数不是1/2/4, 或者控制帧的ID超出ID字段的范围时返回 ErrPBOption
+func NewPBProtocol(opts ...PBOption) (*ProtoBufProtocol, error) {
+	var p = &ProtoBufProtocol{
+		idToProto: map[uint32]protoreflect.MessageType{},
+		protoToId: map[protoreflect.MessageType]uint32{},
+		lenSize:   2,
+		idSize:    2,
+		byteOrder: binary.BigEndian,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if !validFieldSize(p.lenSize) || !validFieldSize(p.idSize) {
+		return nil, ErrPBOption
+	}
+	if p.frames && uint64(p.frameID) > maxUint(p.idSize) {
+		return nil, ErrPBOption
+	}
+	if p.maxSize <= 0 {
+		p.maxSize = DefaultMaxSize
+	}
+	if limit := maxUint(p.lenSize); uint64(p.maxSize) > limit {
+		p.maxSize = int(limit)
+	}
+	return p, nil
+}
+
+func validFieldSize(n int) bool {
+	return n == 1 || n == 2 || n == 4
+}
+
+//reserved id是否是控制帧保留的ID
+func (p *ProtoBufProtocol) reserved(id uint32) bool {
+	return p.frames && id == p.frameID
+}
+
+//Register 注册消息, id不能超过ID字段能表示的范围, 也不能是 PBFrames 保留的ID
+func (p *ProtoBufProtocol) Register(id uint32, t proto.Message) error {
+	if p.reserved(id) {
+		return ErrReservedID
+	}
+	if uint64(id) > maxUint(p.idSize) {
+		return ErrIDOverflow
+	}
 	if _, ok := p.idToProto[id]; ok {
 		return ErrDupliateReg
 	}
@@ -45,6 +143,21 @@ func (p *ProtoBufProtocol) Register(id uint16, t proto.Message) error {
 	return nil
 }
 
+//MessageID 获取消息注册的ID, 实现了 mynet.MessageIdentifier
+func (p *ProtoBufProtocol) MessageID(msg interface{}) (uint32, bool) {
+	pbMsg, ok := msg.(proto.Message)
+	if !ok {
+		return 0, false
+	}
+	id, ok := p.protoToId[pbMsg.ProtoReflect().Type()]
+	return id, ok
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (p *ProtoBufProtocol) WritesEncoded() bool {
+	return true
+}
+
 func (p *ProtoBufProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
 	return &pbCodec{
 		p:         p,
@@ -54,6 +167,11 @@ func (p *ProtoBufProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
 	}, nil
 }
 
+//headSize 包头的长度
+func (p *ProtoBufProtocol) headSize() int {
+	return p.lenSize + p.idSize
+}
+
 type pbCodec struct {
 	p         *ProtoBufProtocol
 	marshal   *proto.MarshalOptions
@@ -62,19 +180,20 @@ type pbCodec struct {
 }
 
 func (p *pbCodec) Receive() (interface{}, error) {
-	var head [4]byte
-	var n, err = io.ReadFull(p.rw, head[:])
-	if n != 4 {
+	var buf [8]byte
+	var head = buf[:p.p.headSize()]
+	var n, err = io.ReadFull(p.rw, head)
+	if n != len(head) {
 		return nil, ErrPackageHead
 	}
 	if err != nil {
 		return nil, err
 	}
-	var size uint16
-	var id uint16
-	var ok bool
-	size = binary.BigEndian.Uint16(head[:2])
-	id = binary.BigEndian.Uint16(head[2:])
+	var size = getUint(p.p.byteOrder, head, p.p.lenSize)
+	var id = uint32(getUint(p.p.byteOrder, head[p.p.lenSize:], p.p.idSize))
+	if size > uint64(p.p.maxSize) {
+		return nil, ErrTooLargePacket
+	}
 
 	var data = make([]byte, size)
 	n, err = io.ReadFull(p.rw, data)
@@ -84,39 +203,174 @@ func (p *pbCodec) Receive() (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	var pt protoreflect.MessageType
-	pt, ok = p.p.idToProto[id]
+	if p.p.reserved(id) {
+		return p.decodeFrame(data)
+	}
+	return p.decodeMessage(id, data)
+}
+
+//decodeMessage 解码一条注册过的消息
+func (p *pbCodec) decodeMessage(id uint32, data []byte) (proto.Message, error) {
+	pt, ok := p.p.idToProto[id]
 	if !ok {
 		return nil, ErrNotRegister
 	}
 	var pb = pt.New().Interface()
 
-	err = p.unmarshal.Unmarshal(data, pb)
+	err := p.unmarshal.Unmarshal(data, pb)
 	return pb, err
 }
 
-func (p *pbCodec) Send(pb interface{}) error {
-	var ok bool
-	var pbMsg proto.Message
-	if pbMsg, ok = pb.(proto.Message); !ok {
-		return ErrMessageType
+//decodeFrame 解码控制帧: kind(1) seq(4), 之后是 id+消息 或者 code(4)+错误信息, 心跳帧没有后续内容
+//seq和code使用包头的字节序
+func (p *pbCodec) decodeFrame(data []byte) (interface{}, error) {
+	if len(data) < 5 {
+		return nil, ErrPackageHead
 	}
-	var id uint16
-	if id, ok = p.p.protoToId[pbMsg.ProtoReflect().Type()]; !ok {
-		return ErrNotRegister
+	var kind = data[0]
+	var seq = p.p.byteOrder.Uint32(data[1:5])
+	data = data[5:]
+	if msg := heartbeatFrame(kind, seq); msg != nil {
+		return msg, nil
+	}
+	if kind == frameError {
+		if len(data) < 4 {
+			return nil, ErrPackageHead
+		}
+		return &mynet.RemoteError{
+			Seq:     seq,
+			Code:    int32(p.p.byteOrder.Uint32(data)),
+			Message: string(data[4:]),
+		}, nil
+	}
+	if len(data) < p.p.idSize {
+		return nil, ErrPackageHead
+	}
+	var id = uint32(getUint(p.p.byteOrder, data, p.p.idSize))
+	body, err := p.decodeMessage(id, data[p.p.idSize:])
+	if err != nil {
+		return nil, err
+	}
+	return wrapFrame(kind, seq, body)
+}
+
+func (p *pbCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(p.rw, p.p, msg)
+	if done {
+		return err
+	}
+
+	// 包头和包体一次写入, 面向消息的连接(如websocket)要求一次Send对应一次Write
+	var headSize = p.p.headSize()
+	var data = make([]byte, headSize, 64)
+	var id = p.p.frameID
+	var frame bool
+	if p.p.frames {
+		data, frame, err = p.appendControl(data, msg)
+	}
+	if !frame {
+		id, data, err = p.appendMessage(data, msg)
 	}
-	var data, err = p.marshal.Marshal(pb.(proto.Message))
 	if err != nil {
 		return err
 	}
-	var head [4]byte
-	binary.BigEndian.PutUint16(head[:2], uint16(len(data)))
-	binary.BigEndian.PutUint16(head[2:], id)
-	p.rw.Write(head[:])
+	var size = len(data) - headSize
+	if size > p.p.maxSize {
+		return ErrTooLargePacket
+	}
+	putUint(p.p.byteOrder, data, p.p.lenSize, uint64(size))
+	putUint(p.p.byteOrder, data[p.p.lenSize:], p.p.idSize, uint64(id))
 	_, err = p.rw.Write(data)
 	return err
 }
 
+//appendMessage 编码一条注册过的消息, 返回消息的ID
+func (p *pbCodec) appendMessage(data []byte, msg interface{}) (uint32, []byte, error) {
+	var ok bool
+	var pbMsg proto.Message
+	if pbMsg, ok = msg.(proto.Message); !ok {
+		return 0, data, ErrMessageType
+	}
+	var id uint32
+	if id, ok = p.p.protoToId[pbMsg.ProtoReflect().Type()]; !ok {
+		return 0, data, ErrNotRegister
+	}
+	data, err := p.marshal.MarshalAppend(data, pbMsg)
+	return id, data, err
+}
+
+//appendControl 编码RPC和心跳的控制帧, msg不是控制帧时返回false
+func (p *pbCodec) appendControl(data []byte, msg interface{}) ([]byte, bool, error) {
+	var err error
+	switch m := msg.(type) {
+	case *mynet.Request:
+		data, err = p.appendFrame(data, frameRequest, m.Seq, m.Body)
+	case *mynet.Response:
+		data, err = p.appendFrame(data, frameResponse, m.Seq, m.Body)
+	case *mynet.RemoteError:
+		data = p.appendFrameHead(data, frameError, m.Seq)
+		data = p.appendUint32(data, uint32(m.Code))
+		data = append(data, m.Message...)
+	case *mynet.Ping:
+		data = p.appendFrameHead(data, framePing, m.Seq)
+	case *mynet.Pong:
+		data = p.appendFrameHead(data, framePong, m.Seq)
+	default:
+		return data, false, nil
+	}
+	return data, true, err
+}
+
+//appendFrame 编码一个带有消息的控制帧
+func (p *pbCodec) appendFrame(data []byte, kind uint8, seq uint32, body interface{}) ([]byte, error) {
+	data = p.appendFrameHead(data, kind, seq)
+	var idPos = len(data)
+	data = append(data, make([]byte, p.p.idSize)...)
+	id, data, err := p.appendMessage(data, body)
+	if err != nil {
+		return data, err
+	}
+	putUint(p.p.byteOrder, data[idPos:], p.p.idSize, uint64(id))
+	return data, nil
+}
+
+func (p *pbCodec) appendFrameHead(data []byte, kind uint8, seq uint32) []byte {
+	data = append(data, kind)
+	return p.appendUint32(data, seq)
+}
+
+func (p *pbCodec) appendUint32(data []byte, v uint32) []byte {
+	var buf [4]byte
+	p.p.byteOrder.PutUint32(buf[:], v)
+	return append(data, buf[:]...)
+}
+
+//maxUint n个字节能表示的最大值
+func maxUint(n int) uint64 {
+	return 1<<(uint(n)*8) - 1
+}
+
+func getUint(order binary.ByteOrder, b []byte, n int) uint64 {
+	switch n {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	}
+	return uint64(order.Uint32(b))
+}
+
+func putUint(order binary.ByteOrder, b []byte, n int, v uint64) {
+	switch n {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		order.PutUint16(b, uint16(v))
+	default:
+		order.PutUint32(b, uint32(v))
+	}
+}
+
 func (p *pbCodec) Close() error {
 	if closer, ok := p.rw.(io.Closer); ok {
 		return closer.Close()
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"io"
+
+	"github.com/ganyyy/mynet"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+//PBMessageProtocol 只收发一种消息的protobuf协议, 数据就是消息的protobuf编码, 没有长度和ID
+//自身不分包, Receive 会一直读到rw返回EOF, 所以需要作为 Varint, FixLen 等分包协议的base使用
+//Varint(PBMessage(t), ...) 和protobuf的delimited格式(protodelim, writeDelimitedTo)相同
+type PBMessageProtocol struct {
+	msgType protoreflect.MessageType
+}
+
+//PBMessage 构建一个只收发t类型消息的协议
+func PBMessage(t proto.Message) *PBMessageProtocol {
+	return &PBMessageProtocol{
+		msgType: t.ProtoReflect().Type(),
+	}
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (p *PBMessageProtocol) WritesEncoded() bool {
+	return true
+}
+
+func (p *PBMessageProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
+	return &pbMessageCodec{
+		p:  p,
+		rw: rw,
+	}, nil
+}
+
+type pbMessageCodec struct {
+	p  *PBMessageProtocol
+	rw io.ReadWriter
+}
+
+func (c *pbMessageCodec) Receive() (interface{}, error) {
+	data, err := io.ReadAll(c.rw)
+	if err != nil {
+		return nil, err
+	}
+	var msg = c.p.msgType.New().Interface()
+	if err = proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+//Send 发送一条消息, 只接受 PBMessage 指定类型的消息, 其他的消息返回 ErrMessageType
+func (c *pbMessageCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(c.rw, c.p, msg)
+	if done {
+		return err
+	}
+	pbMsg, ok := msg.(proto.Message)
+	if !ok || pbMsg.ProtoReflect().Type() != c.p.msgType {
+		return ErrMessageType
+	}
+	data, err := proto.Marshal(pbMsg)
+	if err != nil {
+		return err
+	}
+	_, err = c.rw.Write(data)
+	return err
+}
+
+func (c *pbMessageCodec) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/ganyyy/mynet/proto/option"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var ErrIDCollision = errors.New("message id collision")
+
+//IDCollisionError 两个消息分到了同一个ID, 可以用 errors.Is(err, ErrIDCollision) 判断
+type IDCollisionError struct {
+	ID    uint32
+	Names [2]protoreflect.FullName
+}
+
+func (e *IDCollisionError) Error() string {
+	return ErrIDCollision.Error() + ": " + strconv.FormatUint(uint64(e.ID), 10) +
+		" used by " + string(e.Names[0]) + " and " + string(e.Names[1])
+}
+
+func (e *IDCollisionError) Is(target error) bool {
+	return target == ErrIDCollision
+}
+
+//RegisterFile 注册文件中定义的所有消息(包括嵌套的消息)
+//消息的ID优先使用 option (mynet.msg_id), 没有指定时使用完整名字的哈希, 只要名字不变ID就不变
+//所有的消息都检查通过后才会注册, 出现冲突时返回 IDCollisionError, 不会注册任何消息
+func (p *ProtoBufProtocol) RegisterFile(fd protoreflect.FileDescriptor) error {
+	return p.registerMessages(fileMessages(nil, fd.Messages()))
+}
+
+//RegisterAll 注册 protoregistry.GlobalFiles 中所有使用了 option (mynet.msg_id) 的文件, 规则同 RegisterFile
+//没有使用这个选项的文件(如 google/protobuf 下的文件)会被跳过
+func (p *ProtoBufProtocol) RegisterAll() error {
+	var mds []protoreflect.MessageDescriptor
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		var messages = fileMessages(nil, fd.Messages())
+		for _, md := range messages {
+			if _, ok := optionID(md); ok {
+				mds = append(mds, messages...)
+				break
+			}
+		}
+		return true
+	})
+	return p.registerMessages(mds)
+}
+
+//registerMessages 计算并检查所有消息的ID, 没有问题之后一起注册
+func (p *ProtoBufProtocol) registerMessages(mds []protoreflect.MessageDescriptor) error {
+	var types = make([]protoreflect.MessageType, 0, len(mds))
+	var ids = make([]uint32, 0, len(mds))
+	var names = make(map[uint32]protoreflect.FullName, len(mds))
+	for _, md := range mds {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName())
+		if err != nil {
+			return err
+		}
+		if _, ok := p.protoToId[mt]; ok {
+			return ErrDupliateReg
+		}
+		id, ok := optionID(md)
+		if !ok {
+			id = p.hashID(md.FullName())
+		}
+		if p.reserved(id) {
+			return ErrReservedID
+		}
+		if uint64(id) > maxUint(p.idSize) {
+			return ErrIDOverflow
+		}
+		if exist, ok := p.idToProto[id]; ok {
+			return &IDCollisionError{ID: id, Names: [2]protoreflect.FullName{exist.Descriptor().FullName(), md.FullName()}}
+		}
+		if exist, ok := names[id]; ok {
+			return &IDCollisionError{ID: id, Names: [2]protoreflect.FullName{exist, md.FullName()}}
+		}
+		names[id] = md.FullName()
+		types = append(types, mt)
+		ids = append(ids, id)
+	}
+	for i, mt := range types {
+		p.idToProto[ids[i]] = mt
+		p.protoToId[mt] = ids[i]
+	}
+	return nil
+}
+
+//hashID 根据完整的名字计算一个ID, 范围由ID字段的长度决定. 和 PBFrames 保留的ID相同时使用下一个ID
+func (p *ProtoBufProtocol) hashID(name protoreflect.FullName) uint32 {
+	var h = fnv.New32a()
+	h.Write([]byte(name))
+	var id = h.Sum32() & uint32(maxUint(p.idSize))
+	if p.reserved(id) {
+		id = (id + 1) & uint32(maxUint(p.idSize))
+	}
+	return id
+}
+
+//optionID 读取消息上 option (mynet.msg_id) 的值
+func optionID(md protoreflect.MessageDescriptor) (uint32, bool) {
+	var opts = md.Options()
+	if opts == nil || !proto.HasExtension(opts, option.E_MsgId) {
+		return 0, false
+	}
+	return proto.GetExtension(opts, option.E_MsgId).(uint32), true
+}
+
+//fileMessages 递归收集所有的消息, 跳过map生成的消息
+func fileMessages(mds []protoreflect.MessageDescriptor, messages protoreflect.MessageDescriptors) []protoreflect.MessageDescriptor {
+	for i := 0; i < messages.Len(); i++ {
+		var md = messages.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		mds = append(mds, md)
+		mds = fileMessages(mds, md.Messages())
+	}
+	return mds
+}
@@ -0,0 +1,87 @@
+package codec_test
+
+import (
+	"errors"
+	"mynet/proto/demo"
+	"testing"
+
+	"github.com/ganyyy/mynet/codec"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestPBRegisterFile(t *testing.T) {
+	var pb = codec.PBProtocol()
+	if err := pb.RegisterFile(demo.File_test_proto); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := pb.MessageID(&demo.Req{}); id != 1 {
+		t.Fatalf("Req id = %d", id)
+	}
+	if id, _ := pb.MessageID(&demo.Rsp{}); id != 2 {
+		t.Fatalf("Rsp id = %d", id)
+	}
+
+	// 没有指定ID的消息使用名字的哈希, 每次注册的结果都一样
+	hash, ok := pb.MessageID(&demo.Notify{})
+	if !ok || hash == 0 {
+		t.Fatalf("Notify id = %d, %v", hash, ok)
+	}
+	var other = codec.PBProtocol()
+	other.RegisterFile(demo.File_test_proto)
+	if id, _ := other.MessageID(&demo.Notify{}); id != hash {
+		t.Fatalf("Notify id = %d, want %d", id, hash)
+	}
+
+	if err := pb.RegisterFile(demo.File_test_proto); err != codec.ErrDupliateReg {
+		t.Fatalf("register again err = %v", err)
+	}
+
+	var stream safeBuffer
+	c, _ := pb.NewCodec(&stream)
+	c.Send(&demo.Notify{Str: "hello"})
+	msg, err := c.Receive()
+	if n, ok := msg.(*demo.Notify); err != nil || !ok || n.Str != "hello" {
+		t.Fatalf("receive %v, %v", msg, err)
+	}
+}
+
+func TestPBRegisterAll(t *testing.T) {
+	var pb = codec.PBProtocol()
+	if err := pb.RegisterAll(); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := pb.MessageID(&demo.Rsp{}); id != 2 {
+		t.Fatalf("Rsp id = %d", id)
+	}
+	if _, ok := pb.MessageID(&emptypb.Empty{}); ok {
+		t.Fatal("files without msg_id should be skipped")
+	}
+}
+
+func TestPBRegisterCollision(t *testing.T) {
+	var pb = codec.PBProtocol()
+	pb.RegisterFile(demo.File_test_proto)
+	hash, _ := pb.MessageID(&demo.Notify{})
+
+	// 哈希ID被占用时报告冲突, 并且不注册文件中的任何消息
+	pb = codec.PBProtocol()
+	pb.Register(hash, &emptypb.Empty{})
+	var err = pb.RegisterFile(demo.File_test_proto)
+	var collision *codec.IDCollisionError
+	if !errors.Is(err, codec.ErrIDCollision) || !errors.As(err, &collision) {
+		t.Fatalf("err = %v", err)
+	}
+	if collision.ID != hash || collision.Names[1] != "demo.Notify" {
+		t.Fatalf("collision = %v", collision)
+	}
+	if _, ok := pb.MessageID(&demo.Req{}); ok {
+		t.Fatal("Req registered after collision")
+	}
+
+	// 显式指定的ID和已经注册的消息冲突
+	pb = codec.PBProtocol()
+	pb.Register(1, &emptypb.Empty{})
+	if err = pb.RegisterFile(demo.File_test_proto); !errors.Is(err, codec.ErrIDCollision) {
+		t.Fatalf("err = %v", err)
+	}
+}
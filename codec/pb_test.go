@@ -1,7 +1,10 @@
 package codec_test
 
 import (
+	"bytes"
+	"encoding/binary"
 	"mynet/proto/demo"
+	"strings"
 	"sync"
 	"testing"
 
@@ -53,3 +56,98 @@ func PBTest(t *testing.T, protocol mynet.Protocol) {
 func TestPBProto(t *testing.T) {
 	PBTest(t, PBTestProtocol())
 }
+
+//writeCounter 记录每次Write的数据
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestPBHeaderOptions(t *testing.T) {
+	var pb = codec.PBProtocol(codec.PBLenSize(4), codec.PBIDSize(4), codec.PBByteOrder(binary.LittleEndian))
+	if err := pb.Register(70000, &demo.Req{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stream writeCounter
+	c, _ := pb.NewCodec(&stream)
+	var big = strings.Repeat("x", 100000)
+	if err := c.Send(&demo.Req{Str: big}); err != nil {
+		t.Fatal(err)
+	}
+	if stream.writes != 1 {
+		t.Fatalf("writes = %d, want 1", stream.writes)
+	}
+	var head = stream.Bytes()[:8]
+	if id := binary.LittleEndian.Uint32(head[4:]); id != 70000 {
+		t.Fatalf("head id = %d", id)
+	}
+	if size := binary.LittleEndian.Uint32(head); int(size) != stream.Len()-8 {
+		t.Fatalf("head size = %d, body = %d", size, stream.Len()-8)
+	}
+
+	msg, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, ok := msg.(*demo.Req); !ok || req.Str != big {
+		t.Fatalf("receive %T", msg)
+	}
+}
+
+func TestPBMaxSize(t *testing.T) {
+	var pb = codec.PBProtocol(codec.PBIDSize(1), codec.PBMaxSize(16))
+	if err := pb.Register(256, &demo.Rsp{}); err != codec.ErrIDOverflow {
+		t.Fatalf("register err = %v", err)
+	}
+	pb.Register(1, &demo.Req{})
+
+	var stream writeCounter
+	c, _ := pb.NewCodec(&stream)
+	if err := c.Send(&demo.Req{Str: strings.Repeat("x", 32)}); err != codec.ErrTooLargePacket {
+		t.Fatalf("send err = %v", err)
+	}
+	if stream.Len() != 0 {
+		t.Fatalf("written %d bytes", stream.Len())
+	}
+
+	// 默认2字节长度的协议也不再截断超长的消息
+	c, _ = PBTestProtocol().NewCodec(&stream)
+	if err := c.Send(&demo.Req{Str: strings.Repeat("x", 70000)}); err != codec.ErrTooLargePacket {
+		t.Fatalf("send err = %v", err)
+	}
+
+	// 接收时超过上限的包头直接返回错误
+	stream.Write([]byte{0, 32, 1})
+	c, _ = pb.NewCodec(&stream)
+	if _, err := c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+}
+
+func TestPBDefaultMaxSize(t *testing.T) {
+	if _, err := codec.NewPBProtocol(codec.PBLenSize(3)); err != codec.ErrPBOption {
+		t.Fatalf("len size err = %v", err)
+	}
+	if _, err := codec.NewPBProtocol(codec.PBIDSize(8)); err != codec.ErrPBOption {
+		t.Fatalf("id size err = %v", err)
+	}
+
+	// 4字节的长度字段默认也只接受 DefaultMaxSize 以内的消息, 不会按照对端的包头分配内存
+	pb, err := codec.NewPBProtocol(codec.PBLenSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stream bytes.Buffer
+	binary.Write(&stream, binary.BigEndian, uint32(codec.DefaultMaxSize+1))
+	stream.Write([]byte{0, 1})
+	c, _ := pb.NewCodec(&stream)
+	if _, err = c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+}
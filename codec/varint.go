@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/ganyyy/mynet"
+)
+
+var ErrVarintHead = errors.New("varint head overflow")
+
+//varintHead 发送时预留的包头空间, 长度是uvarint的最大长度
+var varintHead [binary.MaxVarintLen64]byte
+
+//VarintProtocol uvarint长度前缀的协议, 和protobuf的delimited格式(protodelim, writeDelimitedTo)兼容
+//兼容要求base直接写入protobuf编码, 如 PBMessage. PBProtocol 在每个消息前面还有自己的长度和ID, 对端无法解析
+type VarintProtocol struct {
+	base    mynet.Protocol // 编解码器
+	maxRecv uint           // 最大接收包长度
+	maxSend uint           // 最大发送包长度
+}
+
+//Varint 构建一个uvarint长度前缀的协议, 超过maxRecv/maxSend的消息返回 ErrTooLargePacket
+//maxRecv/maxSend为0时使用 DefaultMaxSize
+func Varint(base mynet.Protocol, maxRecv, maxSend uint) *VarintProtocol {
+	if maxRecv == 0 {
+		maxRecv = DefaultMaxSize
+	}
+	if maxSend == 0 {
+		maxSend = DefaultMaxSize
+	}
+	return &VarintProtocol{
+		base:    base,
+		maxRecv: maxRecv,
+		maxSend: maxSend,
+	}
+}
+
+//WritesEncoded Codec能直接写入预先编码的消息, 实现了 mynet.EncodedWriter
+func (v *VarintProtocol) WritesEncoded() bool {
+	return true
+}
+
+func (v *VarintProtocol) NewCodec(rw io.ReadWriter) (cc mynet.Codec, err error) {
+	var codec = &varintCodec{
+		rw:             rw,
+		reader:         bufio.NewReader(rw),
+		VarintProtocol: v,
+	}
+	codec.base, err = v.base.NewCodec(&codec.fixLenReadWriter)
+	return codec, err
+}
+
+type varintCodec struct {
+	*VarintProtocol
+	fixLenReadWriter
+
+	base    mynet.Codec
+	head    headReader    // 读取包头
+	reader  *bufio.Reader // 读取缓冲, 包头不需要逐字节读取连接
+	bodyBuf []byte        // 读取消息用的缓冲区
+	rw      io.ReadWriter
+}
+
+//headReader 限制包头最多读取 binary.MaxVarintLen64 个字节, 记录读取时的错误
+type headReader struct {
+	reader *bufio.Reader
+	n      int
+	err    error
+}
+
+func (h *headReader) ReadByte() (byte, error) {
+	if h.n == binary.MaxVarintLen64 {
+		h.err = ErrVarintHead
+		return 0, h.err
+	}
+	h.n++
+	b, err := h.reader.ReadByte()
+	h.err = err
+	return b, err
+}
+
+//readSize 读取uvarint编码的长度
+func (v *varintCodec) readSize() (uint64, error) {
+	v.head = headReader{reader: v.reader}
+	size, err := binary.ReadUvarint(&v.head)
+	if err == nil {
+		return size, nil
+	}
+	if err = v.head.err; err == nil {
+		// 第10个字节溢出, ReadUvarint自己返回的错误
+		return 0, ErrVarintHead
+	}
+	if v.head.n > 1 && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return 0, err
+}
+
+//Receive 消息读取
+func (v *varintCodec) Receive() (interface{}, error) {
+	size, err := v.readSize()
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(v.maxRecv) {
+		return nil, ErrTooLargePacket
+	}
+	if uint64(cap(v.bodyBuf)) < size {
+		v.bodyBuf = make([]byte, size, size+128)
+	}
+	var buff = v.bodyBuf[:size]
+	if _, err = io.ReadFull(v.reader, buff); err != nil {
+		return nil, err
+	}
+	v.recvBuf.Reset(buff)
+	return v.base.Receive()
+}
+
+//Send 消息发送. 先预留最长的包头, 编码后把包头写在消息体的前面, 和消息体一次写入
+func (v *varintCodec) Send(msg interface{}) error {
+	msg, done, err := writeEncoded(v.rw, v.VarintProtocol, msg)
+	if done {
+		return err
+	}
+
+	v.sendBuf.Reset()
+	v.sendBuf.Write(varintHead[:])
+	if err = v.base.Send(msg); err != nil {
+		return err
+	}
+	var buff = v.sendBuf.Bytes()
+	var size = len(buff) - len(varintHead)
+	if uint(size) > v.maxSend {
+		return ErrTooLargePacket
+	}
+	var head [binary.MaxVarintLen64]byte
+	var n = binary.PutUvarint(head[:], uint64(size))
+	var start = len(varintHead) - n
+	copy(buff[start:], head[:n])
+	_, err = v.rw.Write(buff[start:])
+	return err
+}
+
+//Close 关闭解码器
+func (v *varintCodec) Close() error {
+	if closer, ok := v.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mynet/proto/demo"
+	"strings"
+	"testing"
+
+	"github.com/ganyyy/mynet/codec"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestVarint(t *testing.T) {
+	JsonTest(t, codec.Varint(JsonTestProtocol(), 1024, 1024))
+	PBTest(t, codec.Varint(PBTestProtocol(), 1024, 1024))
+}
+
+func TestVarintHead(t *testing.T) {
+	var stream bytes.Buffer
+	c, _ := codec.Varint(JsonTestProtocol(), 1024, 1024).NewCodec(&stream)
+
+	// 短消息只有1字节的包头, 超过127字节使用2字节
+	for _, size := range []int{1, 200} {
+		var msg = &MyMessage1{Field1: strings.Repeat("x", size)}
+		if err := c.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		length, n := binary.Uvarint(stream.Bytes())
+		if int(length) != stream.Len()-n || (size < 100) != (n == 1) {
+			t.Fatalf("head = %d(%d bytes), total %d", length, n, stream.Len())
+		}
+		recv, err := c.Receive()
+		if err != nil || *recv.(*MyMessage1) != *msg {
+			t.Fatalf("receive %v, %v", recv, err)
+		}
+	}
+}
+
+func TestVarintLimit(t *testing.T) {
+	var stream bytes.Buffer
+	c, _ := codec.Varint(JsonTestProtocol(), 16, 16).NewCodec(&stream)
+	if err := c.Send(&MyMessage1{Field1: "hello"}); err != codec.ErrTooLargePacket {
+		t.Fatalf("send err = %v", err)
+	}
+
+	stream.Write([]byte{0x80, 0x01})
+	if _, err := c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+
+	// 超过10字节的包头
+	stream.Reset()
+	stream.Write(bytes.Repeat([]byte{0xff}, 11))
+	if _, err := c.Receive(); err != codec.ErrVarintHead {
+		t.Fatalf("receive err = %v", err)
+	}
+
+	// 第10个字节超过64位
+	c, _ = codec.Varint(JsonTestProtocol(), 16, 16).NewCodec(&stream)
+	stream.Reset()
+	stream.Write(append(bytes.Repeat([]byte{0xff}, 9), 0x02))
+	if _, err := c.Receive(); err != codec.ErrVarintHead {
+		t.Fatalf("receive err = %v", err)
+	}
+
+	// 不完整的包头
+	c, _ = codec.Varint(JsonTestProtocol(), 16, 16).NewCodec(&stream)
+	stream.Reset()
+	stream.Write([]byte{0x80})
+	if _, err := c.Receive(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("receive err = %v", err)
+	}
+}
+
+func TestVarintDefaultMaxSize(t *testing.T) {
+	var stream bytes.Buffer
+	c, _ := codec.Varint(JsonTestProtocol(), 0, 0).NewCodec(&stream)
+	var msg = &MyMessage1{Field1: "hello"}
+	if err := c.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if recv, err := c.Receive(); err != nil || *recv.(*MyMessage1) != *msg {
+		t.Fatalf("receive %v, %v", recv, err)
+	}
+
+	var head [binary.MaxVarintLen64]byte
+	stream.Write(head[:binary.PutUvarint(head[:], codec.DefaultMaxSize+1)])
+	if _, err := c.Receive(); err != codec.ErrTooLargePacket {
+		t.Fatalf("receive err = %v", err)
+	}
+}
+
+//readCounter 统计Read的调用次数
+type readCounter struct {
+	io.ReadWriter
+	reads int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadWriter.Read(p)
+}
+
+func TestVarintBufferedRead(t *testing.T) {
+	var stream = &readCounter{ReadWriter: &bytes.Buffer{}}
+	c, _ := codec.Varint(JsonTestProtocol(), 1024, 1024).NewCodec(stream)
+	const total = 10
+	for i := 0; i < total; i++ {
+		if err := c.Send(&MyMessage1{Field1: strings.Repeat("x", 200)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 包头和包体通过缓冲读取, 不会逐字节读取连接
+	for i := 0; i < total; i++ {
+		if _, err := c.Receive(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stream.reads != 1 {
+		t.Fatalf("read %d times", stream.reads)
+	}
+}
+
+func TestVarintProtodelim(t *testing.T) {
+	var stream bytes.Buffer
+	c, _ := codec.Varint(codec.PBMessage(&demo.Req{}), 0, 0).NewCodec(&stream)
+	var msgs = []*demo.Req{{Str: "hello"}, {Str: strings.Repeat("x", 200)}, {}}
+
+	// 发送的数据可以按照delimited格式解析
+	for _, msg := range msgs {
+		if err := c.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var data = stream.Bytes()
+	for _, msg := range msgs {
+		body, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		data = data[n:]
+		var recv demo.Req
+		if err := proto.Unmarshal(body, &recv); err != nil || !proto.Equal(&recv, msg) {
+			t.Fatalf("unmarshal %v, %v", &recv, err)
+		}
+	}
+	if len(data) != 0 {
+		t.Fatalf("%d bytes left", len(data))
+	}
+
+	// delimited格式写入的数据可以直接接收
+	stream.Reset()
+	for _, msg := range msgs {
+		body, _ := proto.Marshal(msg)
+		stream.Write(protowire.AppendBytes(nil, body))
+	}
+	for _, msg := range msgs {
+		recv, err := c.Receive()
+		if err != nil || !proto.Equal(recv.(*demo.Req), msg) {
+			t.Fatalf("receive %v, %v", recv, err)
+		}
+	}
+
+	if err := c.Send(&demo.Rsp{}); err != codec.ErrMessageType {
+		t.Fatalf("send err = %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package mynet
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// 合并写入时缓冲区的默认大小阈值
+const defaultFlushSize = 64 * 1024
+
+//messageConn 面向消息的连接(如websocket), 每次Write对应一条消息
+//合并写入时不能把多条消息拼在一起, 由连接自己一次写入多条消息
+type messageConn interface {
+	writeMessages(msgs net.Buffers) error
+}
+
+//sessionConn Session使用的连接, 统计收发的字节数
+//异步Session的发送协程可以把多次Write合并成一次写入, 只有发送协程会在batching期间写入,
+//其他时候直接写到底层连接(如NewCodec中的握手)
+type sessionConn struct {
+	bytesIn  uint64 // 原子操作需要放在开头保证对齐
+	bytesOut uint64
+
+	net.Conn
+	batching bool
+	buf      []byte // 合并的数据
+	ends     []int  // 每次Write在buf中的结束位置, 用来还原消息边界
+}
+
+func newSessionConn(conn net.Conn) *sessionConn {
+	return &sessionConn{Conn: conn}
+}
+
+func (c *sessionConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddUint64(&c.bytesIn, uint64(n))
+	return n, err
+}
+
+func (c *sessionConn) Write(p []byte) (int, error) {
+	if !c.batching {
+		n, err := c.Conn.Write(p)
+		atomic.AddUint64(&c.bytesOut, uint64(n))
+		return n, err
+	}
+	// Codec可能会复用p, 需要拷贝一份
+	c.buf = append(c.buf, p...)
+	c.ends = append(c.ends, len(c.buf))
+	return len(p), nil
+}
+
+//netConn 返回被包装的连接
+func (c *sessionConn) netConn() net.Conn {
+	return c.Conn
+}
+
+//buffered 已经合并的数据大小
+func (c *sessionConn) buffered() int {
+	return len(c.buf)
+}
+
+//begin 开始合并写入
+func (c *sessionConn) begin() {
+	c.batching = true
+}
+
+//flush 结束合并写入, 把合并的数据一次写到底层连接
+func (c *sessionConn) flush() error {
+	c.batching = false
+	if len(c.buf) == 0 {
+		return nil
+	}
+	var err error
+	if mc, ok := c.Conn.(messageConn); ok {
+		var msgs = make(net.Buffers, 0, len(c.ends))
+		var start int
+		for _, end := range c.ends {
+			msgs = append(msgs, c.buf[start:end])
+			start = end
+		}
+		if err = mc.writeMessages(msgs); err == nil {
+			atomic.AddUint64(&c.bytesOut, uint64(len(c.buf)))
+		}
+	} else {
+		var n int
+		n, err = c.Conn.Write(c.buf)
+		atomic.AddUint64(&c.bytesOut, uint64(n))
+	}
+
+	if cap(c.buf) > 4*defaultFlushSize {
+		// 偶尔的大消息不要一直占用内存
+		c.buf, c.ends = nil, nil
+	} else {
+		c.buf, c.ends = c.buf[:0], c.ends[:0]
+	}
+	return err
+}
+
+//sendBatch 发送msg以及队列中已有的消息, 所有消息编码后一次写入
+//设置了flushDelay时会等待一段时间, 合并这段时间内进入队列的消息
+func (s *Session) sendBatch(msg interface{}) (err error) {
+	s.sconn.begin()
+	defer func() {
+		if flushErr := s.sconn.flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	if err = s.encode(msg); err != nil {
+		return err
+	}
+
+	var delay <-chan time.Time
+	if s.flushDelay > 0 {
+		var timer = time.NewTimer(s.flushDelay)
+		defer timer.Stop()
+		delay = timer.C
+	}
+	var flushSize = s.flushSize
+	if flushSize <= 0 {
+		flushSize = defaultFlushSize
+	}
+
+	for s.sconn.buffered() < flushSize {
+		var ok bool
+		select {
+		case msg, ok = <-s.sendChan:
+		default:
+			if delay == nil {
+				// 队列已经空了
+				return nil
+			}
+			select {
+			case msg, ok = <-s.sendChan:
+			case <-delay:
+				return nil
+			case <-s.closeChan:
+				return nil
+			}
+		}
+		if !ok {
+			return nil
+		}
+		if err = s.encode(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package mynet
+
+import "bytes"
+
+//Encoded 预先编码好的消息, 通过 Encode 创建
+//同一个Protocol创建的Codec收到后直接写入编码结果, 其他的Codec按照Msg重新编码
+//Protocol没有实现 EncodedWriter 时, Session会把Msg交给Codec, Codec不会收到*Encoded
+//经过拦截器时msg的类型是*Encoded, 需要原始消息的拦截器可以使用Msg
+type Encoded struct {
+	Msg  interface{} // 原始消息
+	Data []byte      // Codec一次Send写入的完整数据, 不能修改
+
+	protocol Protocol
+}
+
+//EncodedWriter Codec能够处理 *Encoded 的Protocol
+//广播时只为实现了这个接口并且 WritesEncoded 返回true的Protocol预先编码, 其他的Protocol收到原始的消息
+type EncodedWriter interface {
+	Protocol
+	WritesEncoded() bool
+}
+
+//writesEncoded protocol创建的Codec是否能处理 *Encoded
+func writesEncoded(protocol Protocol) bool {
+	w, ok := protocol.(EncodedWriter)
+	return ok && w.WritesEncoded()
+}
+
+//Encode 使用protocol预先编码一条消息, 用于把同一条消息发送给很多Session
+//只适用于每条消息单独编码的Protocol, 在NewCodec中握手或者有连接状态的Protocol会返回错误
+func Encode(protocol Protocol, msg interface{}) (*Encoded, error) {
+	var buf bytes.Buffer
+	codec, err := protocol.NewCodec(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if err = codec.Send(msg); err != nil {
+		return nil, err
+	}
+	return &Encoded{Msg: msg, Data: buf.Bytes(), protocol: protocol}, nil
+}
+
+//Protocol 返回编码使用的Protocol
+func (e *Encoded) Protocol() Protocol {
+	return e.protocol
+}
+
+//encodeCache 广播时每个Protocol只编码一次
+type encodeCache struct {
+	msg     interface{}
+	encoded map[Protocol]*Encoded
+}
+
+func newEncodeCache(msg interface{}) *encodeCache {
+	return &encodeCache{
+		msg:     msg,
+		encoded: make(map[Protocol]*Encoded),
+	}
+}
+
+//message 返回发送给s的消息. 不知道Protocol, Protocol不支持 *Encoded 或者编码失败时返回原始消息
+func (c *encodeCache) message(s *Session) interface{} {
+	if !writesEncoded(s.protocol) {
+		return c.msg
+	}
+	e, ok := c.encoded[s.protocol]
+	if !ok {
+		// 编码失败也记录下来, 不再重复尝试
+		e, _ = Encode(s.protocol, c.msg)
+		c.encoded[s.protocol] = e
+	}
+	if e == nil {
+		return c.msg
+	}
+	return e
+}
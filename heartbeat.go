@@ -0,0 +1,115 @@
+package mynet
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrPongTimeout = errors.New("session pong timeout")
+	ErrIdleTimeout = errors.New("session idle timeout")
+)
+
+//Ping 心跳请求, 由Session内部发送, 对端的 Session.Receive 会自动回复Pong
+type Ping struct {
+	Seq uint32
+}
+
+//Pong 心跳回复, 带回对应Ping的序号
+type Pong struct {
+	Seq uint32
+}
+
+//RTT 返回平滑后的往返时间, 需要开启心跳. 还没有收到过Pong时返回0
+func (s *Session) RTT() time.Duration {
+	s.heartbeatMutex.Lock()
+	defer s.heartbeatMutex.Unlock()
+	return s.rtt
+}
+
+//heartbeatLoop 定时发送Ping, 检查Pong超时和空闲超时
+func (s *Session) heartbeatLoop() {
+	var pingC, idleC, pongC <-chan time.Time
+	if s.pingInterval > 0 {
+		var ticker = time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+	if s.idleTimeout > 0 {
+		var ticker = time.NewTicker(s.idleTimeout / 4)
+		defer ticker.Stop()
+		idleC = ticker.C
+	}
+	var pongTimer *time.Timer
+	if s.pongTimeout > 0 {
+		pongTimer = time.NewTimer(s.pongTimeout)
+		pongTimer.Stop()
+		defer pongTimer.Stop()
+		pongC = pongTimer.C
+	}
+
+	for {
+		select {
+		case <-pingC:
+			s.heartbeatMutex.Lock()
+			if s.waitPong {
+				// 上一个Ping还没有回复, 等待超时检查
+				s.heartbeatMutex.Unlock()
+				continue
+			}
+			s.pingSeq++
+			s.pingTime = time.Now()
+			s.waitPong = true
+			var ping = &Ping{Seq: s.pingSeq}
+			s.heartbeatMutex.Unlock()
+
+			// 对端不读取时Send可能一直阻塞(同步发送或者 BackpressureBlock), 放在单独的协程中发送
+			// 这样Pong和空闲的检查不受影响, 超时关闭Session之后阻塞的Send也会返回
+			go s.Send(ping)
+			if pongTimer != nil {
+				pongTimer.Reset(s.pongTimeout)
+			}
+		case <-pongC:
+			s.heartbeatMutex.Lock()
+			var timeout = s.waitPong
+			s.heartbeatMutex.Unlock()
+			if timeout {
+				s.CloseWithError(ErrPongTimeout)
+				return
+			}
+		case <-idleC:
+			var lastRecv = time.Unix(0, atomic.LoadInt64(&s.lastRecv))
+			if time.Since(lastRecv) > s.idleTimeout {
+				s.CloseWithError(ErrIdleTimeout)
+				return
+			}
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+//handleHeartbeat 处理收到的Ping和Pong, 返回这条消息是否是心跳
+func (s *Session) handleHeartbeat(msg interface{}) bool {
+	switch m := msg.(type) {
+	case *Ping:
+		s.Send(&Pong{Seq: m.Seq})
+		return true
+	case *Pong:
+		s.heartbeatMutex.Lock()
+		defer s.heartbeatMutex.Unlock()
+		if s.waitPong && m.Seq == s.pingSeq {
+			s.waitPong = false
+			var sample = time.Since(s.pingTime)
+			if s.rtt == 0 {
+				s.rtt = sample
+			} else {
+				// 和TCP一样使用1/8的平滑系数
+				s.rtt += (sample - s.rtt) / 8
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package mynet_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+func heartbeatSessions(t *testing.T, opts1, opts2 []mynet.SessionOption) (*mynet.Session, *mynet.Session) {
+	var protocol = serverTestProtocol()
+	c1, c2 := net.Pipe()
+	codec1, _ := protocol.NewCodec(c1)
+	codec2, _ := protocol.NewCodec(c2)
+	return mynet.NewSession(codec1, 16, opts1...), mynet.NewSession(codec2, 16, opts2...)
+}
+
+func receiveLoop(s *mynet.Session) {
+	for {
+		if _, err := s.Receive(); err != nil {
+			return
+		}
+	}
+}
+
+func waitClosed(t *testing.T, s *mynet.Session, timeout time.Duration) {
+	select {
+	case <-s.Done():
+	case <-time.After(timeout):
+		t.Fatal("session should be closed")
+	}
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	client, server := heartbeatSessions(t, []mynet.SessionOption{mynet.WithHeartbeat(10*time.Millisecond, time.Second)}, nil)
+	defer client.Close()
+	defer server.Close()
+	go receiveLoop(client)
+	go receiveLoop(server)
+
+	var deadline = time.Now().Add(time.Second)
+	for client.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no rtt sample")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if server.RTT() != 0 {
+		t.Fatal("server without heartbeat should not have rtt")
+	}
+
+	// 正常回复Pong的Session不会被关闭
+	time.Sleep(50 * time.Millisecond)
+	if client.IsClosed() || server.IsClosed() {
+		t.Fatal("session closed with heartbeat")
+	}
+}
+
+func TestHeartbeatPongTimeout(t *testing.T) {
+	client, server := heartbeatSessions(t, []mynet.SessionOption{mynet.WithHeartbeat(10*time.Millisecond, 50*time.Millisecond)}, nil)
+	defer server.Close()
+
+	// 对端不处理接收循环, 收不到Pong
+	waitClosed(t, client, time.Second)
+	if client.Err() != mynet.ErrPongTimeout {
+		t.Fatalf("expect pong timeout, got %v", client.Err())
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	client, server := heartbeatSessions(t, nil, []mynet.SessionOption{mynet.WithIdleTimeout(50 * time.Millisecond)})
+	defer client.Close()
+	go receiveLoop(server)
+
+	if err := client.Send(&serverMessage{Seq: 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if server.IsClosed() {
+		t.Fatal("session closed before idle timeout")
+	}
+	waitClosed(t, server, time.Second)
+	if server.Err() != mynet.ErrIdleTimeout {
+		t.Fatalf("expect idle timeout, got %v", server.Err())
+	}
+}
+
+func TestHeartbeatStuckPeer(t *testing.T) {
+	var cases = []struct {
+		opts []mynet.SessionOption
+		err  error
+	}{
+		{[]mynet.SessionOption{mynet.WithHeartbeat(10*time.Millisecond, 50*time.Millisecond)}, mynet.ErrPongTimeout},
+		{[]mynet.SessionOption{mynet.WithHeartbeat(10*time.Millisecond, 0), mynet.WithIdleTimeout(50 * time.Millisecond)}, mynet.ErrIdleTimeout},
+	}
+	for _, c := range cases {
+		var protocol = serverTestProtocol()
+		c1, c2 := net.Pipe()
+		defer c2.Close()
+		codec, _ := protocol.NewCodec(c1)
+		// 同步发送的Session, 对端不读取时Send阻塞在写连接上
+		var client = mynet.NewSession(codec, 0, c.opts...)
+		go client.Send(&serverMessage{Seq: 1})
+
+		waitClosed(t, client, time.Second)
+		if client.Err() != c.err {
+			t.Fatalf("expect %v, got %v", c.err, client.Err())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package mynet
+
+//SendFunc 发送一条消息
+type SendFunc func(msg interface{}) error
+
+//ReceiveFunc 接收一条消息
+type ReceiveFunc func() (interface{}, error)
+
+//Interceptor 消息拦截器, 可以检查/修改/拒绝/统计经过 Session.Send 和 Session.Receive 的每一条消息
+//多个拦截器按注册的顺序嵌套调用, 先注册的在最外层. 不调用next就相当于拒绝了这条消息
+//拦截器返回的错误会原样返回给调用者, 不会关闭Session
+type Interceptor interface {
+	InterceptSend(s *Session, msg interface{}, next SendFunc) error
+	InterceptReceive(s *Session, next ReceiveFunc) (interface{}, error)
+}
+
+//SendInterceptorFunc 只拦截发送的Interceptor
+type SendInterceptorFunc func(s *Session, msg interface{}, next SendFunc) error
+
+func (f SendInterceptorFunc) InterceptSend(s *Session, msg interface{}, next SendFunc) error {
+	return f(s, msg, next)
+}
+
+func (f SendInterceptorFunc) InterceptReceive(s *Session, next ReceiveFunc) (interface{}, error) {
+	return next()
+}
+
+//ReceiveInterceptorFunc 只拦截接收的Interceptor
+type ReceiveInterceptorFunc func(s *Session, next ReceiveFunc) (interface{}, error)
+
+func (f ReceiveInterceptorFunc) InterceptSend(s *Session, msg interface{}, next SendFunc) error {
+	return next(msg)
+}
+
+func (f ReceiveInterceptorFunc) InterceptReceive(s *Session, next ReceiveFunc) (interface{}, error) {
+	return f(s, next)
+}
+
+// 接口类型检查
+var (
+	_ Interceptor = SendInterceptorFunc(nil)
+	_ Interceptor = ReceiveInterceptorFunc(nil)
+)
+
+//chainSend 把拦截器串联到发送函数上
+func chainSend(s *Session, interceptors []Interceptor, send SendFunc) SendFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		var interceptor, next = interceptors[i], send
+		send = func(msg interface{}) error {
+			return interceptor.InterceptSend(s, msg, next)
+		}
+	}
+	return send
+}
+
+//chainReceive 把拦截器串联到接收函数上
+func chainReceive(s *Session, interceptors []Interceptor, receive ReceiveFunc) ReceiveFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		var interceptor, next = interceptors[i], receive
+		receive = func() (interface{}, error) {
+			return interceptor.InterceptReceive(s, next)
+		}
+	}
+	return receive
+}
@@ -0,0 +1,70 @@
+package mynet_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+)
+
+func pipeSessions(t *testing.T, sendChanSize int) (*mynet.Session, *mynet.Session) {
+	var protocol = serverTestProtocol()
+	c1, c2 := net.Pipe()
+	codec1, _ := protocol.NewCodec(c1)
+	codec2, _ := protocol.NewCodec(c2)
+	return mynet.NewSession(codec1, sendChanSize), mynet.NewSession(codec2, sendChanSize)
+}
+
+func TestInterceptor(t *testing.T) {
+	var errReject = errors.New("reject")
+	var order []string
+
+	var record = func(name string) mynet.Interceptor {
+		return mynet.SendInterceptorFunc(func(s *mynet.Session, msg interface{}, next mynet.SendFunc) error {
+			order = append(order, name)
+			return next(msg)
+		})
+	}
+
+	sender, receiver := pipeSessions(t, 0)
+	defer sender.Close()
+	defer receiver.Close()
+
+	sender.Use(record("first"), record("second"))
+	sender.Use(mynet.SendInterceptorFunc(func(s *mynet.Session, msg interface{}, next mynet.SendFunc) error {
+		var m = msg.(*serverMessage)
+		if m.Seq < 0 {
+			return errReject
+		}
+		// 修改发送的消息
+		return next(&serverMessage{Seq: m.Seq * 10})
+	}))
+	receiver.Use(mynet.ReceiveInterceptorFunc(func(s *mynet.Session, next mynet.ReceiveFunc) (interface{}, error) {
+		msg, err := next()
+		if err != nil {
+			return nil, err
+		}
+		msg.(*serverMessage).Seq++
+		return msg, nil
+	}))
+
+	if err := sender.Send(&serverMessage{Seq: -1}); err != errReject {
+		t.Fatalf("message should be rejected, got %v", err)
+	}
+	if sender.IsClosed() {
+		t.Fatal("rejected message should not close session")
+	}
+
+	go sender.Send(&serverMessage{Seq: 1})
+	msg, err := receiver.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.(*serverMessage).Seq != 11 {
+		t.Fatalf("message not intercepted: %v", msg)
+	}
+	if len(order) != 4 || order[0] != "first" || order[1] != "second" {
+		t.Fatalf("interceptor order not match: %v", order)
+	}
+}
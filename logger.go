@@ -0,0 +1,38 @@
+package mynet
+
+import "sync/atomic"
+
+//Logger 记录Session生命周期的日志接口, 标准库的 *log.Logger 实现了这个接口
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+//atomic.Value 要求每次存储的类型一致, 所以包装一层
+type loggerHolder struct {
+	Logger
+}
+
+var globalLogger atomic.Value
+
+//SetLogger 设置全局的日志, 没有通过 WithLogger 单独设置的Session都使用它. 默认不输出日志
+func SetLogger(logger Logger) {
+	globalLogger.Store(loggerHolder{logger})
+}
+
+//WithLogger 单独设置Session使用的日志
+func WithLogger(logger Logger) SessionOption {
+	return func(s *Session) {
+		s.logger = logger
+	}
+}
+
+func (s *Session) logf(format string, v ...interface{}) {
+	var logger = s.logger
+	if logger == nil {
+		holder, _ := globalLogger.Load().(loggerHolder)
+		logger = holder.Logger
+	}
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
@@ -1,6 +1,9 @@
 package mynet
 
-import "sync"
+import (
+	"net"
+	"sync"
+)
 
 const (
 	sessionMapNum = 32
@@ -18,6 +21,9 @@ type Manager struct {
 	sessionMaps [sessionMapNum]*sessionMap
 	disposeOnce sync.Once
 	disposeWait sync.WaitGroup
+
+	statsMutex sync.Mutex
+	closed     SessionStats // 已经关闭的Session的统计
 }
 
 //NewManager 创建一个新的Session管理器
@@ -31,14 +37,14 @@ func NewManager() *Manager {
 	return m
 }
 
-//Dispose 关闭管理器
+//Dispose 关闭管理器, 所有Session以 ErrServerClosed 为原因关闭
 func (m *Manager) Dispose() {
 	m.disposeOnce.Do(func() {
 		for _, sm := range m.sessionMaps {
 			sm.mutex.Lock()
 			sm.dispose = true
 			for _, ses := range sm.sessions {
-				ses.Close()
+				ses.CloseWithError(ErrServerClosed)
 			}
 			sm.mutex.Unlock()
 		}
@@ -47,9 +53,80 @@ func (m *Manager) Dispose() {
 	})
 }
 
+//fetch 遍历所有的Session. 回调中不能再操作Manager
+func (m *Manager) fetch(callback func(*Session)) {
+	for _, sm := range m.sessionMaps {
+		sm.mutex.RLock()
+		for _, ses := range sm.sessions {
+			callback(ses)
+		}
+		sm.mutex.RUnlock()
+	}
+}
+
+//Get 根据ID查找Session, 不存在时返回nil
+func (m *Manager) Get(id uint64) *Session {
+	var smap = m.sessionMaps[id%sessionMapNum]
+	smap.mutex.RLock()
+	defer smap.mutex.RUnlock()
+	return smap.sessions[id]
+}
+
+//Len 当前Session的数量
+func (m *Manager) Len() int {
+	var n int
+	for _, sm := range m.sessionMaps {
+		sm.mutex.RLock()
+		n += len(sm.sessions)
+		sm.mutex.RUnlock()
+	}
+	return n
+}
+
+//Range 遍历所有的Session, callback返回false时停止遍历
+//每个分区先复制一份再回调, 回调中可以关闭Session或者创建新的Session
+func (m *Manager) Range(callback func(*Session) bool) {
+	var sessions []*Session
+	for _, sm := range m.sessionMaps {
+		sm.mutex.RLock()
+		sessions = sessions[:0]
+		for _, ses := range sm.sessions {
+			sessions = append(sessions, ses)
+		}
+		sm.mutex.RUnlock()
+
+		for _, ses := range sessions {
+			if !callback(ses) {
+				return
+			}
+		}
+	}
+}
+
+//Broadcast 给所有满足filter的Session发送消息, filter为nil时发给所有的Session. 返回发送成功的数量
+//每个Protocol只编码一次, 参考 Encode
+func (m *Manager) Broadcast(msg interface{}, filter func(*Session) bool) int {
+	var n int
+	var cache = newEncodeCache(msg)
+	m.Range(func(ses *Session) bool {
+		if filter == nil || filter(ses) {
+			if ses.Send(cache.message(ses)) == nil {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
 //NewSession 基于编码和缓冲队列创建一个新的Session
-func (m *Manager) NewSession(codec Codec, sendChanSize int) *Session {
-	ses := newSession(m, codec, sendChanSize)
+func (m *Manager) NewSession(codec Codec, sendChanSize int, opts ...SessionOption) *Session {
+	return m.newConnSession(nil, nil, codec, sendChanSize, opts)
+}
+
+//newConnSession 创建一个持有底层连接的Session
+func (m *Manager) newConnSession(conn net.Conn, protocol Protocol, codec Codec, sendChanSize int, opts []SessionOption) *Session {
+	ses := newSession(m, conn, protocol, codec, sendChanSize, opts)
 	m.putSession(ses)
 	return ses
 }
@@ -57,28 +134,27 @@ func (m *Manager) NewSession(codec Codec, sendChanSize int) *Session {
 //putSession 加入一个Session
 func (m *Manager) putSession(s *Session) {
 	var smap = m.sessionMaps[s.id%sessionMapNum]
+	smap.mutex.Lock()
 	if smap.dispose {
-		s.Close()
+		smap.mutex.Unlock()
+		s.CloseWithError(ErrServerClosed)
 		return
 	}
-	smap.mutex.Lock()
 	smap.sessions[s.id] = s
-	smap.mutex.Unlock()
 	m.disposeWait.Add(1)
+	smap.mutex.Unlock()
 }
 
 //delSession 删除一个Session
 func (m *Manager) delSession(s *Session) {
+	// Dispose 时也需要移除, 否则 disposeWait 永远等不到结束
 	var smap = m.sessionMaps[s.id%sessionMapNum]
-	if smap.dispose {
-		return
-	}
-
 	smap.mutex.Lock()
 	defer smap.mutex.Unlock()
 	if _, ok := smap.sessions[s.id]; !ok {
 		return
 	}
 	delete(smap.sessions, s.id)
+	m.addClosedStats(s.Stats())
 	m.disposeWait.Done()
 }
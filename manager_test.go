@@ -0,0 +1,67 @@
+package mynet_test
+
+import (
+	"testing"
+
+	"github.com/ganyyy/mynet"
+)
+
+//discardCodec 丢弃所有发送的消息
+type discardCodec struct{}
+
+func (discardCodec) Receive() (interface{}, error) { return nil, nil }
+func (discardCodec) Send(interface{}) error        { return nil }
+func (discardCodec) Close() error                  { return nil }
+
+func TestManagerQuery(t *testing.T) {
+	const total = 100
+	var manager = mynet.NewManager()
+	defer manager.Dispose()
+
+	var ids = make(map[uint64]*mynet.Session)
+	for i := 0; i < total; i++ {
+		ses := manager.NewSession(discardCodec{}, 0)
+		ses.State = i
+		ids[ses.ID()] = ses
+	}
+	if manager.Len() != total {
+		t.Fatalf("expect %v sessions, got %v", total, manager.Len())
+	}
+	for id, ses := range ids {
+		if manager.Get(id) != ses {
+			t.Fatalf("session %v not found", id)
+		}
+	}
+	if manager.Get(0) != nil {
+		t.Fatal("unknown id should return nil")
+	}
+
+	// 遍历中可以关闭Session
+	var visited int
+	manager.Range(func(ses *mynet.Session) bool {
+		visited++
+		if ses.State.(int)%2 == 0 {
+			ses.Close()
+		}
+		return true
+	})
+	if visited != total {
+		t.Fatalf("expect visit %v, got %v", total, visited)
+	}
+
+	visited = 0
+	manager.Range(func(ses *mynet.Session) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Fatalf("range should stop, visited %v", visited)
+	}
+
+	var sent = manager.Broadcast(&serverMessage{Seq: 1}, func(ses *mynet.Session) bool {
+		return ses.State.(int)%4 == 1
+	})
+	if sent != total/4 {
+		t.Fatalf("expect broadcast to %v, got %v", total/4, sent)
+	}
+}
@@ -0,0 +1,62 @@
+package mynet
+
+import "time"
+
+//SessionOption Session的可选配置, 在Session启动之前生效
+type SessionOption func(*Session)
+
+//Backpressure 异步发送队列满了之后的处理策略
+type Backpressure int
+
+const (
+	BackpressureClose        Backpressure = iota // 关闭Session并返回 ErrSessionBlocked, 默认的策略
+	BackpressureBlock                            // 阻塞到队列有空位或者Session关闭
+	BackpressureBlockTimeout                     // 最多阻塞一段时间, 超时后丢弃消息并返回 ErrMessageDropped
+	BackpressureDropNewest                       // 丢弃正在发送的消息并返回 ErrMessageDropped
+	BackpressureDropOldest                       // 丢弃队列中最早的消息, 为正在发送的消息腾出位置
+)
+
+//WithHeartbeat 每隔interval发送一次Ping, 对端在pongTimeout内没有回复Pong时关闭Session
+//pongTimeout为0时只发送Ping不检查回复. Pong的往返时间会用来估算 Session.RTT
+//Ping和Pong都在 Session.Receive 中处理, 所以需要有协程在执行接收循环
+//要求两端的Codec都能编码 *Ping 和 *Pong: codec包中的 JsonProtocol 支持, ProtoBufProtocol 需要开启 codec.PBFrames,
+//FixLen 等包装协议取决于内部的Protocol. 其他的Codec发送第一个Ping时就会失败, Session以写入错误关闭
+func WithHeartbeat(interval, pongTimeout time.Duration) SessionOption {
+	return func(s *Session) {
+		s.pingInterval = interval
+		s.pongTimeout = pongTimeout
+	}
+}
+
+//WithIdleTimeout 超过timeout没有收到任何消息(包括Ping和Pong)时关闭Session
+func WithIdleTimeout(timeout time.Duration) SessionOption {
+	return func(s *Session) {
+		s.idleTimeout = timeout
+	}
+}
+
+//WithBackpressure 设置异步发送队列满了之后的处理策略, timeout只在 BackpressureBlockTimeout 时使用
+func WithBackpressure(policy Backpressure, timeout time.Duration) SessionOption {
+	return func(s *Session) {
+		s.backpressure = policy
+		s.blockTimeout = timeout
+	}
+}
+
+//WithWriteCoalescing 设置异步Session合并写入的参数
+//发送协程会把队列中的消息编码到同一个缓冲区后一次写入, delay是取到第一条消息后额外等待的时间,
+//size是缓冲区的大小阈值, 达到后立即写入. 为0时分别表示不等待和使用默认的64KB
+func WithWriteCoalescing(delay time.Duration, size int) SessionOption {
+	return func(s *Session) {
+		s.flushDelay = delay
+		s.flushSize = size
+	}
+}
+
+//WithDropCallback 设置消息因为队列满了被丢弃时的回调, 可以用来做统计
+//回调在Send的协程中执行, 不能再调用当前Session的Send
+func WithDropCallback(callback func(s *Session, msg interface{})) SessionOption {
+	return func(s *Session) {
+		s.onDrop = callback
+	}
+}
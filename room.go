@@ -0,0 +1,318 @@
+package mynet
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRoomFull      = errors.New("room full")
+	ErrRoomClosed    = errors.New("room closed")
+	ErrRoomJoined    = errors.New("room already joined")
+	ErrRoomNotMember = errors.New("not a member of parent room")
+	ErrRoomExists    = errors.New("room already exists")
+)
+
+//RoomConfig 房间的配置
+type RoomConfig struct {
+	Capacity     int           // 最多的成员数, 0表示不限制
+	EmptyTimeout time.Duration // 没有成员和子房间超过这个时间后自动关闭, 0表示不自动关闭
+
+	OnJoin func(r *Room, key KEY, s *Session)
+	// err是离开的原因: 主动离开为nil, Session关闭时为 Session.Err, 房间关闭时为 ErrRoomClosed
+	OnLeave   func(r *Room, key KEY, s *Session, err error)
+	OnDispose func(r *Room)
+
+	// 生成通知其他成员的消息, 为nil或者返回nil时不通知. 同一条消息只编码一次
+	Presence func(r *Room, key KEY, joined bool) interface{}
+}
+
+//Room 基于Channel的房间. 有成员上限, 成员的Session关闭时自动离开
+//房间可以嵌套(如 大厅 -> 比赛 -> 队伍), 加入子房间需要先是父房间的成员, 离开父房间时也会离开所有的子房间
+//钩子函数在锁外执行, 可以在钩子中操作房间
+//成员只能通过 Join 和 Leave 修改, 内部的Channel不对外暴露, 保证容量, 钩子和子房间的处理不被绕过
+type Room struct {
+	channel *Channel
+
+	name   string
+	config RoomConfig
+	parent *Room
+
+	mutex      sync.Mutex
+	children   map[string]*Room
+	emptyTimer *time.Timer
+	closed     bool
+}
+
+//NewRoom 创建一个顶层的房间
+func NewRoom(name string, config *RoomConfig) *Room {
+	var r = &Room{
+		channel:  NewChannel(),
+		name:     name,
+		children: make(map[string]*Room),
+	}
+	if config != nil {
+		r.config = *config
+	}
+	// 创建后一直没有人加入也需要关闭
+	r.checkEmpty()
+	return r
+}
+
+//Name 房间的名字
+func (r *Room) Name() string {
+	return r.name
+}
+
+//Parent 父房间, 顶层的房间返回nil
+func (r *Room) Parent() *Room {
+	return r.parent
+}
+
+//NewRoom 创建一个子房间
+func (r *Room) NewRoom(name string, config *RoomConfig) (*Room, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil, ErrRoomClosed
+	}
+	if _, exist := r.children[name]; exist {
+		return nil, ErrRoomExists
+	}
+	var child = NewRoom(name, config)
+	child.parent = r
+	r.children[name] = child
+	r.stopEmptyTimer()
+	return child, nil
+}
+
+//Room 根据名字查找子房间, 不存在时返回nil
+func (r *Room) Room(name string) *Room {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.children[name]
+}
+
+//IsClosed 房间是否已经关闭
+func (r *Room) IsClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.closed
+}
+
+//Len 房间的成员数
+func (r *Room) Len() int {
+	return r.channel.Len()
+}
+
+//Get 根据key查找成员, 不存在时返回nil
+func (r *Room) Get(key KEY) *Session {
+	return r.channel.Get(key)
+}
+
+//Fetch 遍历所有的成员
+func (r *Room) Fetch(callback func(*Session)) {
+	r.channel.Fetch(callback)
+}
+
+//Broadcast 向所有的成员发送消息, 同一条消息只编码一次, 返回发送成功的数量
+func (r *Room) Broadcast(msg interface{}) int {
+	return r.channel.Broadcast(msg)
+}
+
+//Join 加入房间
+func (r *Room) Join(key KEY, s *Session) error {
+	var err error
+	if p := r.parent; p != nil {
+		// 持有父房间的锁直到加入完成, 避免父房间同时的leave漏掉这个子房间. 锁的顺序总是先父后子
+		p.mutex.Lock()
+		if p.channel.Get(key) != s {
+			err = ErrRoomNotMember
+		} else {
+			err = r.add(key, s)
+		}
+		p.mutex.Unlock()
+	} else {
+		err = r.add(key, s)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.AddCloseCallback(r, key, func(err error) {
+		r.leave(key, s, err)
+	})
+	if s.IsClosed() {
+		// 加入的过程中Session关闭了, 回调可能没有注册上
+		r.leave(key, s, s.Err())
+		return ErrSessionClosed
+	}
+
+	if r.config.OnJoin != nil {
+		r.config.OnJoin(r, key, s)
+	}
+	r.notify(key, true)
+	return nil
+}
+
+//Leave 离开房间, 同时离开所有的子房间
+func (r *Room) Leave(key KEY) bool {
+	var s = r.channel.Get(key)
+	if s == nil {
+		return false
+	}
+	return r.leave(key, s, nil)
+}
+
+//add 检查并加入成员
+func (r *Room) add(key KEY, s *Session) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrRoomClosed
+	}
+	if r.channel.Get(key) != nil {
+		return ErrRoomJoined
+	}
+	if r.config.Capacity > 0 && r.channel.Len() >= r.config.Capacity {
+		return ErrRoomFull
+	}
+	r.channel.mutex.Lock()
+	r.channel.sessionMap[key] = s
+	r.channel.mutex.Unlock()
+	r.stopEmptyTimer()
+	return nil
+}
+
+func (r *Room) leave(key KEY, s *Session, err error) bool {
+	r.mutex.Lock()
+	r.channel.mutex.Lock()
+	if r.channel.sessionMap[key] != s {
+		r.channel.mutex.Unlock()
+		r.mutex.Unlock()
+		return false
+	}
+	delete(r.channel.sessionMap, key)
+	r.channel.mutex.Unlock()
+	var children = r.childList()
+	r.mutex.Unlock()
+
+	s.RemoveCloseCallback(key, r)
+	for _, child := range children {
+		child.leave(key, s, err)
+	}
+	if r.config.OnLeave != nil {
+		r.config.OnLeave(r, key, s, err)
+	}
+	r.notify(key, false)
+	r.checkEmpty()
+	return true
+}
+
+//Close 关闭房间和所有的子房间, 所有成员以 ErrRoomClosed 为原因离开
+func (r *Room) Close() {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return
+	}
+	r.closed = true
+	r.stopEmptyTimer()
+	var children = r.childList()
+	r.children = make(map[string]*Room)
+	r.channel.mutex.Lock()
+	var members = r.channel.sessionMap
+	r.channel.sessionMap = make(map[KEY]*Session)
+	r.channel.mutex.Unlock()
+	r.mutex.Unlock()
+
+	for _, child := range children {
+		child.Close()
+	}
+	for key, s := range members {
+		s.RemoveCloseCallback(key, r)
+		if r.config.OnLeave != nil {
+			r.config.OnLeave(r, key, s, ErrRoomClosed)
+		}
+	}
+	if r.parent != nil {
+		r.parent.removeChild(r)
+	}
+	if r.config.OnDispose != nil {
+		r.config.OnDispose(r)
+	}
+}
+
+func (r *Room) removeChild(child *Room) {
+	r.mutex.Lock()
+	if r.children[child.name] == child {
+		delete(r.children, child.name)
+	}
+	r.mutex.Unlock()
+	r.checkEmpty()
+}
+
+//childList 复制一份子房间, 需要在外边持有mutex
+func (r *Room) childList() []*Room {
+	var children = make([]*Room, 0, len(r.children))
+	for _, child := range r.children {
+		children = append(children, child)
+	}
+	return children
+}
+
+//notify 通知其他成员key的加入或者离开
+func (r *Room) notify(key KEY, joined bool) {
+	if r.config.Presence == nil {
+		return
+	}
+	var msg = r.config.Presence(r, key, joined)
+	if msg == nil {
+		return
+	}
+	r.channel.mutex.RLock()
+	var others = make([]*Session, 0, len(r.channel.sessionMap))
+	for k, s := range r.channel.sessionMap {
+		if k != key {
+			others = append(others, s)
+		}
+	}
+	r.channel.mutex.RUnlock()
+
+	var cache = newEncodeCache(msg)
+	for _, s := range others {
+		s.Send(cache.message(s))
+	}
+}
+
+//checkEmpty 房间空了之后开始计时, 超时后自动关闭
+func (r *Room) checkEmpty() {
+	if r.config.EmptyTimeout <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed || r.emptyTimer != nil || r.channel.Len() > 0 || len(r.children) > 0 {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(r.config.EmptyTimeout, func() {
+		r.mutex.Lock()
+		// 计时期间有人加入会停止计时器, 这里还需要确认是同一个计时器
+		var expired = r.emptyTimer == timer && r.channel.Len() == 0 && len(r.children) == 0
+		r.mutex.Unlock()
+		if expired {
+			r.Close()
+		}
+	})
+	r.emptyTimer = timer
+}
+
+//stopEmptyTimer 停止空房间的计时, 需要在外边持有mutex
+func (r *Room) stopEmptyTimer() {
+	if r.emptyTimer != nil {
+		r.emptyTimer.Stop()
+		r.emptyTimer = nil
+	}
+}
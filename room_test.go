@@ -0,0 +1,199 @@
+package mynet_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+//roomEvents 记录房间的事件
+type roomEvents struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (e *roomEvents) add(event string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *roomEvents) has(event string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, ev := range e.events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+func roomConfig(events *roomEvents) *mynet.RoomConfig {
+	return &mynet.RoomConfig{
+		OnJoin: func(r *mynet.Room, key mynet.KEY, s *mynet.Session) {
+			events.add(r.Name() + " join " + key.(string))
+		},
+		OnLeave: func(r *mynet.Room, key mynet.KEY, s *mynet.Session, err error) {
+			events.add(r.Name() + " leave " + key.(string))
+		},
+		OnDispose: func(r *mynet.Room) {
+			events.add(r.Name() + " dispose")
+		},
+	}
+}
+
+func TestRoom(t *testing.T) {
+	var events = &roomEvents{}
+	var config = roomConfig(events)
+	config.Capacity = 2
+	config.Presence = func(r *mynet.Room, key mynet.KEY, joined bool) interface{} {
+		if joined {
+			return &serverMessage{Seq: 1}
+		}
+		return &serverMessage{Seq: -1}
+	}
+	var room = mynet.NewRoom("lobby", config)
+	defer room.Close()
+
+	a, peerA := pipeSessions(t, 16)
+	b, peerB := pipeSessions(t, 16)
+	c, peerC := pipeSessions(t, 16)
+	defer peerA.Close()
+	defer peerB.Close()
+	defer peerC.Close()
+
+	if err := room.Join("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.Join("a", a); err != mynet.ErrRoomJoined {
+		t.Fatalf("expect joined, got %v", err)
+	}
+	if err := room.Join("b", b); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.Join("c", c); err != mynet.ErrRoomFull {
+		t.Fatalf("expect full, got %v", err)
+	}
+
+	// a 收到 b 加入的通知, b 自己不会收到
+	if msg, err := peerA.Receive(); err != nil || msg.(*serverMessage).Seq != 1 {
+		t.Fatalf("expect join presence, got %v %v", msg, err)
+	}
+
+	// Session关闭后自动离开
+	b.Close()
+	if msg, err := peerA.Receive(); err != nil || msg.(*serverMessage).Seq != -1 {
+		t.Fatalf("expect leave presence, got %v %v", msg, err)
+	}
+	if room.Len() != 1 || !events.has("lobby leave b") {
+		t.Fatalf("b should leave room: %v", events.events)
+	}
+	if err := room.Join("c", c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoomNested(t *testing.T) {
+	var events = &roomEvents{}
+	var lobby = mynet.NewRoom("lobby", roomConfig(events))
+	defer lobby.Close()
+	match, err := lobby.NewRoom("match", roomConfig(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	team, err := match.NewRoom("team", roomConfig(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lobby.NewRoom("match", nil); err != mynet.ErrRoomExists {
+		t.Fatalf("expect exists, got %v", err)
+	}
+
+	a, peerA := pipeSessions(t, 16)
+	defer a.Close()
+	defer peerA.Close()
+
+	if err = team.Join("a", a); err != mynet.ErrRoomNotMember {
+		t.Fatalf("expect not member, got %v", err)
+	}
+	for _, r := range []*mynet.Room{lobby, match, team} {
+		if err = r.Join("a", a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 离开父房间时同时离开子房间
+	lobby.Leave("a")
+	if match.Len() != 0 || team.Len() != 0 || !events.has("team leave a") {
+		t.Fatalf("should leave nested rooms: %v", events.events)
+	}
+
+	// 关闭父房间时关闭子房间
+	match.Close()
+	if !team.IsClosed() || lobby.Room("match") != nil || !events.has("team dispose") {
+		t.Fatalf("nested room not disposed: %v", events.events)
+	}
+}
+
+func TestRoomEmptyTimeout(t *testing.T) {
+	var events = &roomEvents{}
+	var config = roomConfig(events)
+	config.EmptyTimeout = 20 * time.Millisecond
+	var room = mynet.NewRoom("room", config)
+
+	a, peerA := pipeSessions(t, 16)
+	defer a.Close()
+	defer peerA.Close()
+	if err := room.Join("a", a); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if room.IsClosed() {
+		t.Fatal("room with member should not be disposed")
+	}
+
+	room.Leave("a")
+	var deadline = time.Now().Add(time.Second)
+	for !room.IsClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("empty room should be disposed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := room.Join("a", a); err != mynet.ErrRoomClosed {
+		t.Fatalf("expect closed, got %v", err)
+	}
+}
+
+func TestRoomJoinLeaveRace(t *testing.T) {
+	var lobby = mynet.NewRoom("lobby", nil)
+	defer lobby.Close()
+	match, _ := lobby.NewRoom("match", nil)
+
+	a, peerA := pipeSessions(t, 16)
+	defer a.Close()
+	defer peerA.Close()
+
+	// 加入子房间和离开父房间同时进行, 最后不能只留在子房间中
+	for i := 0; i < 200; i++ {
+		lobby.Join("a", a)
+		var wait sync.WaitGroup
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			match.Join("a", a)
+		}()
+		go func() {
+			defer wait.Done()
+			lobby.Leave("a")
+		}()
+		wait.Wait()
+		if match.Get("a") != nil && lobby.Get("a") == nil {
+			t.Fatal("member left lobby but stayed in match")
+		}
+		match.Leave("a")
+	}
+}
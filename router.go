@@ -0,0 +1,124 @@
+package mynet
+
+import (
+	"reflect"
+	"sync"
+)
+
+//MessageIdentifier 可以根据消息获取消息ID的Protocol, 如 codec.ProtoBufProtocol
+type MessageIdentifier interface {
+	MessageID(msg interface{}) (uint32, bool)
+}
+
+//RouteFunc 处理一条消息
+type RouteFunc func(s *Session, msg interface{}) error
+
+//Router 消息分发器, 实现了Handler
+//负责Session的接收循环, 按照消息的类型或者消息ID分发到注册的处理函数
+type Router struct {
+	mutex      sync.RWMutex
+	typeRoutes map[reflect.Type]RouteFunc
+	idRoutes   map[uint32]RouteFunc
+	identifier MessageIdentifier
+
+	unknown func(s *Session, msg interface{})
+	onError func(s *Session, msg interface{}, err error)
+}
+
+// 接口类型检查
+var _ Handler = (*Router)(nil)
+
+//NewRouter 创建一个消息分发器
+func NewRouter() *Router {
+	return &Router{
+		typeRoutes: make(map[reflect.Type]RouteFunc),
+		idRoutes:   make(map[uint32]RouteFunc),
+	}
+}
+
+//Handle 按照消息的类型注册处理函数, msg只用来获取类型, 指针和非指针视为同一种类型
+func (r *Router) Handle(msg interface{}, fn RouteFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.typeRoutes[routeType(msg)] = fn
+}
+
+//HandleID 按照消息ID注册处理函数, 需要通过SetIdentifier设置获取消息ID的方式
+func (r *Router) HandleID(id uint32, fn RouteFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.idRoutes[id] = fn
+}
+
+//SetIdentifier 设置获取消息ID的方式, 一般就是Session使用的Protocol
+func (r *Router) SetIdentifier(identifier MessageIdentifier) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.identifier = identifier
+}
+
+//OnUnknown 设置未注册消息的处理函数, 默认忽略这条消息
+func (r *Router) OnUnknown(fn func(s *Session, msg interface{})) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unknown = fn
+}
+
+//OnError 设置处理函数返回错误时的回调, 默认以这个错误关闭Session
+func (r *Router) OnError(fn func(s *Session, msg interface{}, err error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onError = fn
+}
+
+//HandleSession 接收循环, Session出错后返回
+func (r *Router) HandleSession(s *Session) {
+	for {
+		msg, err := s.Receive()
+		if err != nil {
+			return
+		}
+		r.Dispatch(s, msg)
+	}
+}
+
+//Dispatch 分发一条消息. 优先按照类型查找, 然后再按照消息ID查找
+//*Request 按照其中Body的类型查找, 处理函数收到的仍然是*Request, 以便通过 Session.Reply 回复
+func (r *Router) Dispatch(s *Session, msg interface{}) {
+	var key = msg
+	if req, ok := msg.(*Request); ok {
+		key = req.Body
+	}
+
+	r.mutex.RLock()
+	var fn, ok = r.typeRoutes[routeType(key)]
+	if !ok && r.identifier != nil {
+		if id, exist := r.identifier.MessageID(key); exist {
+			fn, ok = r.idRoutes[id]
+		}
+	}
+	var unknown, onError = r.unknown, r.onError
+	r.mutex.RUnlock()
+
+	if !ok {
+		if unknown != nil {
+			unknown(s, msg)
+		}
+		return
+	}
+	if err := fn(s, msg); err != nil {
+		if onError != nil {
+			onError(s, msg, err)
+		} else {
+			s.CloseWithError(err)
+		}
+	}
+}
+
+func routeType(msg interface{}) reflect.Type {
+	var rt = reflect.TypeOf(msg)
+	if rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return rt
+}
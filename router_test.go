@@ -0,0 +1,84 @@
+package mynet_test
+
+import (
+	"errors"
+	"mynet/proto/demo"
+	"net"
+	"testing"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+)
+
+func TestRouter(t *testing.T) {
+	var protocol = codec.PBProtocol()
+	protocol.Register(1, &demo.Req{})
+	protocol.Register(2, &demo.Rsp{})
+
+	c1, c2 := net.Pipe()
+	codec1, _ := protocol.NewCodec(c1)
+	codec2, _ := protocol.NewCodec(c2)
+	var client = mynet.NewSession(codec1, 0)
+	var server = mynet.NewSession(codec2, 0)
+	defer client.Close()
+
+	var errBad = errors.New("bad request")
+	var result = make(chan string, 4)
+
+	var router = mynet.NewRouter()
+	router.SetIdentifier(protocol)
+	router.Handle(&demo.Req{}, func(s *mynet.Session, msg interface{}) error {
+		var req = msg.(*demo.Req)
+		if req.GetStr() == "bad" {
+			return errBad
+		}
+		result <- "req:" + req.GetStr()
+		return nil
+	})
+	router.HandleID(2, func(s *mynet.Session, msg interface{}) error {
+		result <- "rsp:" + msg.(*demo.Rsp).GetStr()
+		return nil
+	})
+	router.OnError(func(s *mynet.Session, msg interface{}, err error) {
+		result <- "error:" + err.Error()
+		s.Close()
+	})
+
+	var done = make(chan struct{})
+	go func() {
+		router.HandleSession(server)
+		close(done)
+	}()
+
+	client.Send(&demo.Req{Str: "hello"})
+	client.Send(&demo.Rsp{Str: "world"})
+	client.Send(&demo.Req{Str: "bad"})
+
+	for _, expect := range []string{"req:hello", "rsp:world", "error:bad request"} {
+		if got := <-result; got != expect {
+			t.Fatalf("expect %v, got %v", expect, got)
+		}
+	}
+	// 出错后关闭了Session, 接收循环结束
+	<-done
+}
+
+func TestRouterUnknown(t *testing.T) {
+	var router = mynet.NewRouter()
+	var unknown interface{}
+	router.OnUnknown(func(s *mynet.Session, msg interface{}) {
+		unknown = msg
+	})
+	router.Handle(serverMessage{}, func(s *mynet.Session, msg interface{}) error {
+		return nil
+	})
+
+	router.Dispatch(nil, &serverMessage{})
+	if unknown != nil {
+		t.Fatal("registered message should not be unknown")
+	}
+	router.Dispatch(nil, "unknown")
+	if unknown != "unknown" {
+		t.Fatalf("unknown message not match: %v", unknown)
+	}
+}
@@ -0,0 +1,110 @@
+package mynet
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+//Request 带有序号的请求. 调用方通过 Session.Call 发出, 被调用方通过 Session.Receive 收到后用 Session.Reply 回复
+type Request struct {
+	Seq  uint32
+	Body interface{}
+}
+
+//Response 请求的回复, 由 Session.Receive 内部匹配到对应的Call, 不会返回给调用者
+type Response struct {
+	Seq  uint32
+	Body interface{}
+}
+
+//RemoteError 标准的错误帧, 对端处理请求失败时返回, Call会把它作为错误返回
+type RemoteError struct {
+	Seq     uint32
+	Code    int32
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error %d: %s", e.Code, e.Message)
+}
+
+//callResult 等待中的Call的结果
+type callResult struct {
+	body interface{}
+	err  error
+}
+
+//Call 发起一个请求并等待回复. 回复可以乱序到达, 按照序号匹配
+//回复是在 Session.Receive 中处理的, 所以需要有协程在执行接收循环(如 Router.HandleSession)
+func (s *Session) Call(ctx context.Context, req interface{}) (interface{}, error) {
+	var seq = atomic.AddUint32(&s.callSeq, 1)
+	if seq == 0 {
+		// 0 保留给没有序号的消息
+		seq = atomic.AddUint32(&s.callSeq, 1)
+	}
+	var result = make(chan callResult, 1)
+
+	s.callMutex.Lock()
+	if s.calls == nil {
+		s.calls = make(map[uint32]chan callResult)
+	}
+	s.calls[seq] = result
+	s.callMutex.Unlock()
+
+	defer func() {
+		s.callMutex.Lock()
+		delete(s.calls, seq)
+		s.callMutex.Unlock()
+	}()
+
+	if err := s.Send(&Request{Seq: seq, Body: req}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-result:
+		return r.body, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.closeChan:
+		return nil, ErrSessionClosed
+	}
+}
+
+//Reply 回复一个请求
+func (s *Session) Reply(req *Request, body interface{}) error {
+	return s.Send(&Response{Seq: req.Seq, Body: body})
+}
+
+//ReplyError 用错误帧回复一个请求
+func (s *Session) ReplyError(req *Request, code int32, message string) error {
+	return s.Send(&RemoteError{Seq: req.Seq, Code: code, Message: message})
+}
+
+//dispatchCall 把回复交给等待中的Call, 返回这条消息是否是回复
+func (s *Session) dispatchCall(msg interface{}) bool {
+	var seq uint32
+	var result callResult
+	switch m := msg.(type) {
+	case *Response:
+		seq, result.body = m.Seq, m.Body
+	case *RemoteError:
+		seq, result.err = m.Seq, m
+	default:
+		return false
+	}
+
+	s.callMutex.Lock()
+	var ch, ok = s.calls[seq]
+	s.callMutex.Unlock()
+	if ok {
+		// 缓冲区为1, 同一个序号只会有一个回复
+		select {
+		case ch <- result:
+		default:
+		}
+	}
+	// 没有对应的Call(已经超时)的回复直接丢弃
+	return true
+}
@@ -0,0 +1,73 @@
+package mynet_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+func TestCall(t *testing.T) {
+	var router = mynet.NewRouter()
+	router.Handle(serverMessage{}, func(s *mynet.Session, msg interface{}) error {
+		var req = msg.(*mynet.Request)
+		var seq = req.Body.(*serverMessage).Seq
+		// 打乱回复的顺序
+		go func() {
+			time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+			switch {
+			case seq < 0:
+				s.ReplyError(req, 400, "negative seq")
+			case seq == 0:
+				// 不回复, 等待调用方超时
+			default:
+				s.Reply(req, &serverMessage{Seq: seq * 2})
+			}
+		}()
+		return nil
+	})
+
+	client, server := pipeSessions(t, 64)
+	defer client.Close()
+	go router.HandleSession(server)
+	// 客户端也需要接收循环来处理回复
+	go router.HandleSession(client)
+
+	var wait sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wait.Add(1)
+		go func(seq int) {
+			defer wait.Done()
+			rsp, err := client.Call(context.Background(), &serverMessage{Seq: seq})
+			if err != nil {
+				t.Errorf("call %v error:%v", seq, err)
+				return
+			}
+			if rsp.(*serverMessage).Seq != seq*2 {
+				t.Errorf("call %v response not match: %v", seq, rsp)
+			}
+		}(i)
+	}
+	wait.Wait()
+
+	_, err := client.Call(context.Background(), &serverMessage{Seq: -1})
+	var remote *mynet.RemoteError
+	if !errors.As(err, &remote) || remote.Code != 400 {
+		t.Fatalf("expect remote error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = client.Call(ctx, &serverMessage{Seq: 0}); err != context.DeadlineExceeded {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+
+	server.Close()
+	if _, err = client.Call(context.Background(), &serverMessage{Seq: 0}); err != mynet.ErrSessionClosed {
+		t.Fatalf("expect session closed, got %v", err)
+	}
+}
@@ -0,0 +1,753 @@
+//Package rudp 基于UDP的可靠有序传输(参考KCP的实现)
+//提供标准的net.Listener和net.Conn, 可以直接交给 mynet.Accept/Server.Serve 以及各种Protocol使用
+package rudp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDeadLink         = errors.New("rudp: dead link")
+	ErrConnClosed       = errors.New("rudp: use of closed connection")
+	ErrIdleTimeout      = errors.New("rudp: idle timeout")
+	ErrHandshakeTimeout = errors.New("rudp: handshake timeout")
+)
+
+// 段的类型
+const (
+	cmdPush = 1 // 数据
+	cmdAck  = 2 // 确认
+	cmdFin  = 3 // 发送完毕, 和数据一样按序可靠的传输
+
+	// 建立连接的握手, 不可靠, 由客户端重传
+	cmdSyn    = 4 // 客户端请求连接, 携带cookie(第一次为全0)
+	cmdCookie = 5 // 服务器返回cookie, 不创建任何状态
+	cmdSynAck = 6 // 服务器确认连接已经建立
+
+	cmdPing = 7 // 保活, 不可靠, 只用来刷新对端的活跃时间
+)
+
+//cookieSize 握手cookie的长度. 客户端的第一个SYN也会填充这么多字节, 避免被用来放大流量
+const cookieSize = 16
+
+//headSize 段的头部: conv(4) cmd(1) 保留(1) wnd(2) ts(4) sn(4) una(4) len(2)
+const headSize = 22
+
+const (
+	maxRTO     = 60000 // 最大的重传超时(ms)
+	lingerTime = 3000  // 本端关闭后等待对端关闭的时间(ms)
+)
+
+//Config 连接的配置, 零值的字段使用默认值
+type Config struct {
+	MTU           int           // 单个UDP包的最大长度, 默认1400
+	SendWindow    int           // 发送窗口(段数), 默认128
+	RecvWindow    int           // 接收窗口(段数), 默认128
+	Interval      time.Duration // 内部刷新的间隔, 默认10ms
+	MinRTO        time.Duration // 最小的重传超时, 默认50ms
+	FastResend    int           // 被跳过多少次ACK后立即重传, 默认2, 小于0时关闭快速重传
+	DeadLink      int           // 同一个段重传多少次后认为连接断开, 默认10
+	NoCongestion  bool          // 关闭拥塞控制, 只受收发窗口的限制
+	AcceptBacklog int           // Listener等待Accept的连接数, 默认128
+
+	HandshakeTimeout time.Duration // Dial等待握手完成的时间, 默认5s
+	IdleTimeout      time.Duration // 超过这个时间没有收到对端的任何包时断开, 默认30s, 小于0时不检查
+	KeepAlive        time.Duration // 超过这个时间没有发送任何包时发送保活包, 默认IdleTimeout/3, 小于0时不发送
+}
+
+func (c *Config) withDefault() Config {
+	var config Config
+	if c != nil {
+		config = *c
+	}
+	if config.MTU <= headSize {
+		config.MTU = 1400
+	}
+	if config.SendWindow <= 0 {
+		config.SendWindow = 128
+	}
+	if config.RecvWindow <= 0 {
+		config.RecvWindow = 128
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Millisecond
+	}
+	if config.MinRTO <= 0 {
+		config.MinRTO = 50 * time.Millisecond
+	}
+	if config.FastResend == 0 {
+		config.FastResend = 2
+	}
+	if config.DeadLink <= 0 {
+		config.DeadLink = 10
+	}
+	if config.AcceptBacklog <= 0 {
+		config.AcceptBacklog = 128
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = 5 * time.Second
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 30 * time.Second
+	}
+	if config.KeepAlive == 0 && config.IdleTimeout > 0 {
+		config.KeepAlive = config.IdleTimeout / 3
+	}
+	return config
+}
+
+//controlPacket 握手用的包, 只有conv/cmd/len和数据
+func controlPacket(conv uint32, cmd uint8, data []byte) []byte {
+	var packet = make([]byte, headSize+len(data))
+	binary.LittleEndian.PutUint32(packet, conv)
+	packet[4] = cmd
+	binary.LittleEndian.PutUint16(packet[20:], uint16(len(data)))
+	copy(packet[headSize:], data)
+	return packet
+}
+
+//segment 一个传输段
+type segment struct {
+	cmd      uint8
+	sn       uint32
+	ts       uint32 // 发送时间, ACK会原样带回, 用来计算RTT
+	resendTs uint32 // 下次重传的时间
+	rto      uint32
+	xmit     int // 发送的次数
+	fastack  int // 被后续的ACK跳过的次数
+	data     []byte
+}
+
+//ackItem 等待发送的确认
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// 进程内的毫秒时钟, 只用来计算差值
+var clockBase = time.Now()
+
+func currentMs() uint32 {
+	return uint32(time.Since(clockBase) / time.Millisecond)
+}
+
+func durationMs(d time.Duration) int32 {
+	return int32(d / time.Millisecond)
+}
+
+//timeDiff 处理回绕的差值
+func timeDiff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+//Conn 一个可靠有序的UDP连接, 实现了net.Conn
+type Conn struct {
+	conv       uint32
+	config     Config
+	mss        int
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	output     func([]byte) error // 发送一个UDP包
+	release    func()             // 连接彻底结束后的清理
+
+	mutex sync.Mutex
+
+	// 发送相关
+	sndNxt   uint32     // 下一个分配的序号
+	sndUna   uint32     // 最早未确认的序号
+	sndQueue []*segment // 还没有进入发送窗口的段
+	sndBuf   []*segment // 已经发送但还没有确认的段
+	rmtWnd   uint32     // 对端通告的接收窗口
+	cwnd     uint32     // 拥塞窗口
+	ssthresh uint32     // 慢启动阈值
+	incr     uint32     // 拥塞避免阶段的增量(字节)
+
+	// 接收相关
+	rcvNxt   uint32              // 下一个期望的序号
+	rcvBuf   map[uint32]*segment // 乱序到达的段
+	rcvQueue [][]byte            // 已经有序, 等待Read的数据
+	ackList  []ackItem           // 等待发送的确认
+
+	// RTT
+	srtt   int32
+	rttvar int32
+	rto    uint32
+
+	closed       bool   // 本端已经关闭
+	closeTs      uint32 // 本端关闭的时间
+	remoteClosed bool   // 收到了对端的FIN
+	err          error  // 连接异常断开的原因
+	released     bool
+	lastRecv     uint32 // 最后一次收到对端的包的时间
+	lastSend     uint32 // 最后一次发送的时间
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+	dieChan    chan struct{} // 连接彻底结束
+}
+
+func newConn(conv uint32, config Config, localAddr, remoteAddr net.Addr, output func([]byte) error, release func()) *Conn {
+	var c = &Conn{
+		conv:       conv,
+		config:     config,
+		mss:        config.MTU - headSize,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		output:     output,
+		release:    release,
+		rmtWnd:     uint32(config.RecvWindow),
+		cwnd:       1,
+		ssthresh:   2,
+		rcvBuf:     make(map[uint32]*segment),
+		rto:        200,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		dieChan:    make(chan struct{}),
+		lastRecv:   currentMs(),
+		lastSend:   currentMs(),
+	}
+	go c.updateLoop()
+	return c
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+//Read 读取有序的数据, 对端关闭后返回io.EOF
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		c.mutex.Lock()
+		if len(c.rcvQueue) > 0 {
+			var n = 0
+			for len(c.rcvQueue) > 0 && n < len(p) {
+				var copied = copy(p[n:], c.rcvQueue[0])
+				n += copied
+				if copied < len(c.rcvQueue[0]) {
+					c.rcvQueue[0] = c.rcvQueue[0][copied:]
+				} else {
+					c.rcvQueue[0] = nil
+					c.rcvQueue = c.rcvQueue[1:]
+				}
+			}
+			// 接收队列腾出了空间, 可以接收更多乱序的段
+			c.moveRcvBuf()
+			c.mutex.Unlock()
+			return n, nil
+		}
+		if c.closed {
+			c.mutex.Unlock()
+			return 0, ErrConnClosed
+		}
+		if c.err != nil {
+			var err = c.err
+			c.mutex.Unlock()
+			return 0, err
+		}
+		if c.remoteClosed {
+			c.mutex.Unlock()
+			return 0, io.EOF
+		}
+		var deadline = c.readDeadline
+		c.mutex.Unlock()
+
+		if err := c.wait(c.readEvent, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+//Write 写入数据, 发送窗口满的时候会阻塞
+func (c *Conn) Write(p []byte) (int, error) {
+	var n = 0
+	for {
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			return n, ErrConnClosed
+		}
+		if c.err != nil {
+			var err = c.err
+			c.mutex.Unlock()
+			return n, err
+		}
+		// 发送队列最多缓存两个发送窗口的数据
+		for n < len(p) && len(c.sndQueue) < 2*c.config.SendWindow {
+			var size = len(p) - n
+			if size > c.mss {
+				size = c.mss
+			}
+			var data = make([]byte, size)
+			copy(data, p[n:n+size])
+			c.sndQueue = append(c.sndQueue, &segment{cmd: cmdPush, data: data})
+			n += size
+		}
+		c.flush()
+		if n == len(p) {
+			c.mutex.Unlock()
+			return n, nil
+		}
+		var deadline = c.writeDeadline
+		c.mutex.Unlock()
+
+		if err := c.wait(c.writeEvent, deadline); err != nil {
+			return n, err
+		}
+	}
+}
+
+//wait 等待事件/连接结束/超时
+func (c *Conn) wait(event chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		var d = time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		var timer = time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-event:
+	case <-c.dieChan:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+//Close 关闭连接. 已经写入的数据和FIN会在后台继续发送, 不会阻塞
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return ErrConnClosed
+	}
+	c.closed = true
+	c.closeTs = currentMs()
+	if c.err == nil {
+		c.sndQueue = append(c.sndQueue, &segment{cmd: cmdFin})
+		c.flush()
+	}
+	notify(c.readEvent)
+	notify(c.writeEvent)
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	c.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+	notify(c.readEvent)
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.writeDeadline = t
+	c.mutex.Unlock()
+	notify(c.writeEvent)
+	return nil
+}
+
+//updateLoop 定时刷新, 处理重传和连接的清理
+func (c *Conn) updateLoop() {
+	var ticker = time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mutex.Lock()
+			c.flush()
+			c.mutex.Unlock()
+		case <-c.dieChan:
+			return
+		}
+	}
+}
+
+//input 处理收到的UDP包
+func (c *Conn) input(data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.released {
+		return
+	}
+
+	var (
+		oldUna = c.sndUna
+		maxAck uint32
+		hasAck bool
+		now    = currentMs()
+	)
+	for len(data) >= headSize {
+		var (
+			conv   = binary.LittleEndian.Uint32(data)
+			cmd    = data[4]
+			wnd    = binary.LittleEndian.Uint16(data[6:])
+			ts     = binary.LittleEndian.Uint32(data[8:])
+			sn     = binary.LittleEndian.Uint32(data[12:])
+			una    = binary.LittleEndian.Uint32(data[16:])
+			length = int(binary.LittleEndian.Uint16(data[20:]))
+		)
+		data = data[headSize:]
+		if conv != c.conv || length > len(data) {
+			return
+		}
+		c.lastRecv = now
+		if cmd == cmdPing {
+			data = data[length:]
+			continue
+		}
+		c.rmtWnd = uint32(wnd)
+		c.parseUna(una)
+
+		switch cmd {
+		case cmdAck:
+			if timeDiff(now, ts) >= 0 {
+				c.updateRTT(timeDiff(now, ts))
+			}
+			c.parseAck(sn)
+			if !hasAck || timeDiff(sn, maxAck) > 0 {
+				maxAck = sn
+				hasAck = true
+			}
+		case cmdPush, cmdFin:
+			// 超出接收窗口的段直接丢弃, 等对端重传
+			if timeDiff(sn, c.rcvNxt+uint32(c.config.RecvWindow)) < 0 {
+				c.ackList = append(c.ackList, ackItem{sn: sn, ts: ts})
+				if timeDiff(sn, c.rcvNxt) >= 0 {
+					if _, exist := c.rcvBuf[sn]; !exist {
+						var payload = make([]byte, length)
+						copy(payload, data[:length])
+						c.rcvBuf[sn] = &segment{cmd: cmd, sn: sn, data: payload}
+					}
+				}
+			}
+		default:
+			return
+		}
+		data = data[length:]
+	}
+
+	if hasAck {
+		c.parseFastAck(maxAck)
+	}
+	c.moveRcvBuf()
+
+	// 有新的数据被确认, 扩大拥塞窗口
+	if timeDiff(c.sndUna, oldUna) > 0 && c.cwnd < c.rmtWnd {
+		var mss = uint32(c.mss)
+		if c.cwnd < c.ssthresh {
+			c.cwnd++
+			c.incr += mss
+		} else {
+			if c.incr < mss {
+				c.incr = mss
+			}
+			c.incr += (mss*mss)/c.incr + mss/16
+			if (c.cwnd+1)*mss <= c.incr {
+				c.cwnd++
+			}
+		}
+		if c.cwnd > c.rmtWnd {
+			c.cwnd = c.rmtWnd
+			c.incr = c.rmtWnd * mss
+		}
+	}
+	c.flush()
+}
+
+//parseUna 累计确认, 移除una之前的所有段
+func (c *Conn) parseUna(una uint32) {
+	var i = 0
+	for i < len(c.sndBuf) && timeDiff(una, c.sndBuf[i].sn) > 0 {
+		i++
+	}
+	if i > 0 {
+		c.sndBuf = c.sndBuf[i:]
+		c.shrinkBuf()
+	}
+}
+
+//parseAck 选择确认, 移除指定的段
+func (c *Conn) parseAck(sn uint32) {
+	if timeDiff(sn, c.sndUna) < 0 || timeDiff(sn, c.sndNxt) >= 0 {
+		return
+	}
+	for i, seg := range c.sndBuf {
+		if seg.sn == sn {
+			c.sndBuf = append(c.sndBuf[:i], c.sndBuf[i+1:]...)
+			break
+		}
+		if timeDiff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+	c.shrinkBuf()
+}
+
+//parseFastAck 被跳过的段记录次数, 用来快速重传
+func (c *Conn) parseFastAck(sn uint32) {
+	for _, seg := range c.sndBuf {
+		if timeDiff(sn, seg.sn) <= 0 {
+			break
+		}
+		seg.fastack++
+	}
+}
+
+func (c *Conn) shrinkBuf() {
+	if len(c.sndBuf) > 0 {
+		c.sndUna = c.sndBuf[0].sn
+	} else {
+		c.sndUna = c.sndNxt
+	}
+	notify(c.writeEvent)
+}
+
+func (c *Conn) updateRTT(rtt int32) {
+	if c.srtt == 0 {
+		c.srtt = rtt
+		c.rttvar = rtt / 2
+	} else {
+		var delta = rtt - c.srtt
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttvar = (3*c.rttvar + delta) / 4
+		c.srtt = (7*c.srtt + rtt) / 8
+		if c.srtt < 1 {
+			c.srtt = 1
+		}
+	}
+	var interval = int32(c.config.Interval / time.Millisecond)
+	if interval < 4*c.rttvar {
+		interval = 4 * c.rttvar
+	}
+	var rto = uint32(c.srtt + interval)
+	var minRTO = uint32(c.config.MinRTO / time.Millisecond)
+	if rto < minRTO {
+		rto = minRTO
+	}
+	if rto > maxRTO {
+		rto = maxRTO
+	}
+	c.rto = rto
+}
+
+//moveRcvBuf 把有序的段移动到接收队列
+func (c *Conn) moveRcvBuf() {
+	var moved = false
+	for len(c.rcvQueue) < c.config.RecvWindow {
+		var seg, ok = c.rcvBuf[c.rcvNxt]
+		if !ok {
+			break
+		}
+		delete(c.rcvBuf, c.rcvNxt)
+		c.rcvNxt++
+		moved = true
+		if seg.cmd == cmdFin {
+			c.remoteClosed = true
+			continue
+		}
+		if len(seg.data) > 0 {
+			c.rcvQueue = append(c.rcvQueue, seg.data)
+		}
+	}
+	if moved {
+		notify(c.readEvent)
+	}
+}
+
+//recvWindow 通告给对端的接收窗口
+func (c *Conn) recvWindow() uint16 {
+	if len(c.rcvQueue) < c.config.RecvWindow {
+		return uint16(c.config.RecvWindow - len(c.rcvQueue))
+	}
+	return 0
+}
+
+//flush 发送确认, 发送新的段以及处理重传. 需要在外边持有锁
+func (c *Conn) flush() {
+	if c.released {
+		return
+	}
+
+	var (
+		now    = currentMs()
+		wnd    = c.recvWindow()
+		buffer = make([]byte, 0, c.config.MTU)
+	)
+	var emit = func(seg *segment) {
+		if len(buffer)+headSize+len(seg.data) > c.config.MTU {
+			c.output(buffer)
+			c.lastSend = now
+			buffer = make([]byte, 0, c.config.MTU)
+		}
+		var head [headSize]byte
+		binary.LittleEndian.PutUint32(head[0:], c.conv)
+		head[4] = seg.cmd
+		binary.LittleEndian.PutUint16(head[6:], wnd)
+		binary.LittleEndian.PutUint32(head[8:], seg.ts)
+		binary.LittleEndian.PutUint32(head[12:], seg.sn)
+		binary.LittleEndian.PutUint32(head[16:], c.rcvNxt)
+		binary.LittleEndian.PutUint16(head[20:], uint16(len(seg.data)))
+		buffer = append(buffer, head[:]...)
+		buffer = append(buffer, seg.data...)
+	}
+
+	// 确认
+	for _, ack := range c.ackList {
+		emit(&segment{cmd: cmdAck, sn: ack.sn, ts: ack.ts})
+	}
+	c.ackList = c.ackList[:0]
+
+	if c.err == nil {
+		// 计算可用的发送窗口
+		var window = uint32(c.config.SendWindow)
+		if c.rmtWnd < window {
+			window = c.rmtWnd
+		}
+		if !c.config.NoCongestion && c.cwnd < window {
+			window = c.cwnd
+		}
+		// 对端窗口为0时也允许发送一个段来探测
+		if window == 0 {
+			window = 1
+		}
+		for len(c.sndQueue) > 0 && timeDiff(c.sndNxt, c.sndUna+window) < 0 {
+			var seg = c.sndQueue[0]
+			c.sndQueue[0] = nil
+			c.sndQueue = c.sndQueue[1:]
+			seg.sn = c.sndNxt
+			c.sndNxt++
+			c.sndBuf = append(c.sndBuf, seg)
+		}
+		if len(c.sndQueue) < 2*c.config.SendWindow {
+			notify(c.writeEvent)
+		}
+
+		var lost, change bool
+		for _, seg := range c.sndBuf {
+			var send = false
+			switch {
+			case seg.xmit == 0:
+				send = true
+				seg.rto = c.rto
+				seg.resendTs = now + seg.rto
+			case timeDiff(now, seg.resendTs) >= 0:
+				// 超时重传
+				send = true
+				lost = true
+				seg.rto += seg.rto / 2
+				if seg.rto > maxRTO {
+					seg.rto = maxRTO
+				}
+				seg.resendTs = now + seg.rto
+			case c.config.FastResend > 0 && seg.fastack >= c.config.FastResend:
+				// 快速重传
+				send = true
+				change = true
+				seg.fastack = 0
+				seg.resendTs = now + seg.rto
+			}
+			if !send {
+				continue
+			}
+			seg.xmit++
+			seg.ts = now
+			emit(seg)
+			if seg.xmit > c.config.DeadLink {
+				c.err = ErrDeadLink
+			}
+		}
+
+		// 拥塞控制
+		if change {
+			var inflight = c.sndNxt - c.sndUna
+			c.ssthresh = inflight / 2
+			if c.ssthresh < 2 {
+				c.ssthresh = 2
+			}
+			c.cwnd = c.ssthresh + uint32(c.config.FastResend)
+			c.incr = c.cwnd * uint32(c.mss)
+		}
+		if lost {
+			c.ssthresh = c.cwnd / 2
+			if c.ssthresh < 2 {
+				c.ssthresh = 2
+			}
+			c.cwnd = 1
+			c.incr = uint32(c.mss)
+		}
+	}
+
+	if c.err == nil && !c.closed {
+		// 对端长时间没有任何响应, 包括没有数据要发送时的保活
+		if c.config.IdleTimeout > 0 && timeDiff(now, c.lastRecv) > durationMs(c.config.IdleTimeout) {
+			c.err = ErrIdleTimeout
+		} else if c.config.KeepAlive > 0 && len(buffer) == 0 && timeDiff(now, c.lastSend) >= durationMs(c.config.KeepAlive) {
+			emit(&segment{cmd: cmdPing})
+		}
+	}
+
+	if len(buffer) > 0 {
+		c.output(buffer)
+		c.lastSend = now
+	}
+
+	// 连接彻底结束: 异常断开, 或者本端关闭后数据都已经确认, 并且对端也关闭了(或者等待超时)
+	if c.err != nil ||
+		c.closed && len(c.sndQueue) == 0 && len(c.sndBuf) == 0 &&
+			(c.remoteClosed || timeDiff(now, c.closeTs) > lingerTime) {
+		c.die()
+	}
+}
+
+//abort 直接结束连接, 不再通知对端
+func (c *Conn) abort() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.released {
+		return
+	}
+	if c.err == nil {
+		c.err = ErrConnClosed
+	}
+	c.die()
+}
+
+//die 释放连接, 需要在外边持有锁
+func (c *Conn) die() {
+	c.released = true
+	close(c.dieChan)
+	go c.release()
+}
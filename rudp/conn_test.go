@@ -0,0 +1,281 @@
+package rudp_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+	"github.com/ganyyy/mynet/rudp"
+)
+
+//lossyConn 随机丢包的PacketConn
+type lossyConn struct {
+	net.PacketConn
+	mutex sync.Mutex
+	rand  *rand.Rand
+	loss  float64
+}
+
+func (l *lossyConn) drop() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rand.Float64() < l.loss
+}
+
+func (l *lossyConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := l.PacketConn.ReadFrom(p)
+		if err != nil || !l.drop() {
+			return n, addr, err
+		}
+	}
+}
+
+func (l *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if l.drop() {
+		return len(p), nil
+	}
+	return l.PacketConn.WriteTo(p, addr)
+}
+
+func TestLossyTransfer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config = &rudp.Config{MinRTO: 20 * time.Millisecond, DeadLink: 50}
+	var listener = rudp.NewListener(&lossyConn{
+		PacketConn: pc,
+		rand:       rand.New(rand.NewSource(1)),
+		loss:       0.2,
+	}, config)
+	defer listener.Close()
+
+	var data = make([]byte, 256*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// 原样返回收到的数据
+		io.Copy(conn, conn)
+		conn.Close()
+	}()
+
+	client, err := rudp.Dial("udp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	go client.Write(data)
+	client.SetReadDeadline(time.Now().Add(20 * time.Second))
+	var recv = make([]byte, len(data))
+	if _, err = io.ReadFull(client, recv); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, recv) {
+		t.Fatal("data not match")
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	listener, err := rudp.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := rudp.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err = client.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expect timeout error, got %v", err)
+	}
+}
+
+type rudpMessage struct {
+	Seq int
+}
+
+func TestServer(t *testing.T) {
+	var protocol = codec.Json()
+	protocol.Register(rudpMessage{})
+
+	listener, err := rudp.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server = mynet.NewServer(listener, protocol, 16, mynet.HandlerFunc(func(s *mynet.Session) {
+		for {
+			msg, err := s.Receive()
+			if err != nil {
+				return
+			}
+			s.Send(msg)
+		}
+	}))
+	go server.Serve()
+	defer listener.Close()
+
+	conn, err := rudp.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, _ := protocol.NewCodec(conn)
+	var client = mynet.NewSession(cc, 0)
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		if err = client.Send(&rudpMessage{Seq: i}); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*rudpMessage).Seq != i {
+			t.Fatalf("message %v not match: %v", i, msg)
+		}
+	}
+}
+
+func TestHandshakeCookie(t *testing.T) {
+	listener, err := rudp.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	raw, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	// 没有握手的数据段不会创建连接
+	var push = make([]byte, 22+4)
+	push[0], push[4], push[20] = 1, 1, 4
+	raw.Write(push)
+
+	// 没有cookie的SYN只会收到同样长度的cookie
+	var syn = make([]byte, 22+16)
+	syn[0], syn[4], syn[20] = 1, 4, 16
+	raw.Write(syn)
+	raw.SetReadDeadline(time.Now().Add(time.Second))
+	var buf = make([]byte, 1500)
+	n, err := raw.Read(buf)
+	if err != nil || n != len(syn) || buf[4] != 5 {
+		t.Fatalf("cookie reply %d bytes cmd %d, %v", n, buf[4], err)
+	}
+
+	var accepted = make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("connection accepted without handshake")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 带上cookie之后连接建立
+	copy(syn[22:], buf[22:n])
+	raw.Write(syn)
+	if n, err = raw.Read(buf); err != nil || buf[4] != 6 {
+		t.Fatalf("syn-ack cmd %d, %v", buf[4], err)
+	}
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	var config = &rudp.Config{IdleTimeout: 100 * time.Millisecond, KeepAlive: -1}
+	listener, err := rudp.Listen("udp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addr = listener.Addr().String()
+
+	// 对端停止响应(这里是关闭了保活)后, 连接在IdleTimeout后断开
+	client, err := rudp.Dial("udp", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != rudp.ErrIdleTimeout {
+		t.Fatalf("read err = %v", err)
+	}
+
+	// 所有的连接结束后关闭Listener会释放端口
+	listener.Close()
+	time.Sleep(50 * time.Millisecond)
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("port not released: %v", err)
+	}
+	pc.Close()
+}
+
+func TestKeepAlive(t *testing.T) {
+	var config = &rudp.Config{IdleTimeout: 100 * time.Millisecond, KeepAlive: 20 * time.Millisecond}
+	listener, err := rudp.Listen("udp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := rudp.Dial("udp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有数据的时候保活包维持连接
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, err = conn.Read(make([]byte, 1)); err == nil || err == rudp.ErrIdleTimeout {
+		t.Fatalf("read err = %v", err)
+	}
+	if _, err = client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	// 没有回复的地址
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, err = rudp.Dial("udp", pc.LocalAddr().String(), &rudp.Config{HandshakeTimeout: 100 * time.Millisecond}); err != rudp.ErrHandshakeTimeout {
+		t.Fatalf("dial err = %v", err)
+	}
+}
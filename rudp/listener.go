@@ -0,0 +1,294 @@
+package rudp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+//cookiePeriod cookie的有效时间为1到2个周期
+const cookiePeriod = 10 * time.Second
+
+//Listener 在一个UDP端口上按照对端地址区分不同的连接, 实现了net.Listener
+//关闭Listener后只是不再接收新的连接, 已有的连接全部结束后才会关闭底层的UDP端口
+//
+//新的连接需要先完成握手: 客户端发送SYN, 服务器返回根据对端地址计算的cookie, 客户端带上cookie再次发送SYN后才会创建连接
+//服务器在这之前不保存任何状态, 伪造源地址的包无法占用连接和Accept队列
+type Listener struct {
+	conn   net.PacketConn
+	config Config
+	secret []byte // 计算cookie的密钥
+
+	mutex    sync.Mutex
+	sessions map[string]*Conn
+	closed   bool
+
+	acceptChan chan *Conn
+	closeChan  chan struct{}
+	closeOnce  sync.Once
+}
+
+//Listen 监听一个UDP地址
+func Listen(network, addr string, config *Config) (*Listener, error) {
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(conn, config), nil
+}
+
+//NewListener 基于已有的PacketConn创建Listener, Listener会接管conn的关闭
+func NewListener(conn net.PacketConn, config *Config) *Listener {
+	var l = &Listener{
+		conn:      conn,
+		config:    config.withDefault(),
+		secret:    make([]byte, sha256.Size),
+		sessions:  make(map[string]*Conn),
+		closeChan: make(chan struct{}),
+	}
+	rand.Read(l.secret)
+	l.acceptChan = make(chan *Conn, l.config.AcceptBacklog)
+	go l.readLoop()
+	return l
+}
+
+func (l *Listener) readLoop() {
+	var buf = make([]byte, 65536)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			l.closeAll()
+			return
+		}
+		if n < headSize {
+			continue
+		}
+		var data = buf[:n]
+		var key = addr.String()
+
+		l.mutex.Lock()
+		var c, exist = l.sessions[key]
+		if !exist {
+			if !l.closed {
+				l.handshake(data, addr, key)
+			}
+			l.mutex.Unlock()
+			continue
+		}
+		l.mutex.Unlock()
+		if data[4] == cmdSyn {
+			// 客户端没有收到SYN-ACK, 重新确认
+			if binary.LittleEndian.Uint32(data) == c.conv {
+				l.conn.WriteTo(controlPacket(c.conv, cmdSynAck, nil), addr)
+			}
+			continue
+		}
+		c.input(data)
+	}
+}
+
+//handshake 处理没有连接的地址发来的包, 需要在外边持有mutex
+//只有带着有效cookie的SYN才会创建连接, 其他的包直接忽略
+func (l *Listener) handshake(data []byte, addr net.Addr, key string) {
+	if data[4] != cmdSyn || len(data) != headSize+cookieSize {
+		return
+	}
+	var conv = binary.LittleEndian.Uint32(data)
+	var cookie = data[headSize:]
+	var now = time.Now().Unix() / int64(cookiePeriod/time.Second)
+	if !hmac.Equal(cookie, l.cookie(key, conv, now)) && !hmac.Equal(cookie, l.cookie(key, conv, now-1)) {
+		// 第一次握手或者cookie已经过期, 返回新的cookie. 回复和请求一样长, 不会放大流量
+		l.conn.WriteTo(controlPacket(conv, cmdCookie, l.cookie(key, conv, now)), addr)
+		return
+	}
+
+	var c = newConn(conv, l.config, l.conn.LocalAddr(), addr,
+		func(b []byte) error {
+			_, err := l.conn.WriteTo(b, addr)
+			return err
+		},
+		func() {
+			l.remove(key)
+		})
+	select {
+	case l.acceptChan <- c:
+		l.sessions[key] = c
+		l.conn.WriteTo(controlPacket(conv, cmdSynAck, nil), addr)
+	default:
+		// 等待Accept的连接太多了, 不回复, 等对端重传
+		c.abort()
+	}
+}
+
+//cookie 根据对端地址, conv和时间段计算cookie
+func (l *Listener) cookie(key string, conv uint32, period int64) []byte {
+	var mac = hmac.New(sha256.New, l.secret)
+	var buf [12]byte
+	binary.LittleEndian.PutUint32(buf[:], conv)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(period))
+	mac.Write(buf[:])
+	mac.Write([]byte(key))
+	return mac.Sum(nil)[:cookieSize]
+}
+
+//Accept 等待一个新的连接
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.acceptChan:
+		return c, nil
+	case <-l.closeChan:
+		return nil, net.ErrClosed
+	}
+}
+
+//Close 不再接收新的连接
+func (l *Listener) Close() error {
+	var err = net.ErrClosed
+	l.closeOnce.Do(func() {
+		err = nil
+		close(l.closeChan)
+		l.mutex.Lock()
+		l.closed = true
+		var empty = len(l.sessions) == 0
+		l.mutex.Unlock()
+
+		// 没有被Accept的连接直接丢弃
+		for {
+			select {
+			case c := <-l.acceptChan:
+				c.abort()
+				continue
+			default:
+			}
+			break
+		}
+		if empty {
+			l.conn.Close()
+		}
+	})
+	return err
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+//remove 连接结束后移除
+func (l *Listener) remove(key string) {
+	l.mutex.Lock()
+	delete(l.sessions, key)
+	var shutdown = l.closed && len(l.sessions) == 0
+	l.mutex.Unlock()
+	if shutdown {
+		l.conn.Close()
+	}
+}
+
+//closeAll 底层的端口出错, 所有的连接都无法继续
+func (l *Listener) closeAll() {
+	l.closeOnce.Do(func() {
+		close(l.closeChan)
+	})
+	l.mutex.Lock()
+	l.closed = true
+	var sessions = l.sessions
+	l.sessions = make(map[string]*Conn)
+	l.mutex.Unlock()
+	for _, c := range sessions {
+		c.abort()
+	}
+}
+
+//Dial 连接一个UDP地址
+func Dial(network, addr string, config *Config) (*Conn, error) {
+	raddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP(network, nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var conv [4]byte
+	if _, err = rand.Read(conv[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var cfg = config.withDefault()
+	if err = dialHandshake(conn, binary.LittleEndian.Uint32(conv[:]), cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var c = newConn(binary.LittleEndian.Uint32(conv[:]), cfg, conn.LocalAddr(), raddr,
+		func(b []byte) error {
+			_, err := conn.Write(b)
+			return err
+		},
+		func() {
+			conn.Close()
+		})
+	go func() {
+		var buf = make([]byte, 65536)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				c.abort()
+				return
+			}
+			c.input(buf[:n])
+		}
+	}()
+	return c, nil
+}
+
+//dialHandshake 客户端的握手, 定时重发SYN直到收到SYN-ACK或者超时
+func dialHandshake(conn *net.UDPConn, conv uint32, config Config) error {
+	var deadline = time.Now().Add(config.HandshakeTimeout)
+	var retry = 4 * config.MinRTO
+	var cookie = make([]byte, cookieSize)
+	var buf = make([]byte, 65536)
+	for time.Now().Before(deadline) {
+		if _, err := conn.Write(controlPacket(conv, cmdSyn, cookie)); err != nil {
+			return err
+		}
+		var wait = time.Now().Add(retry)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return err
+			}
+			if n < headSize || binary.LittleEndian.Uint32(buf) != conv {
+				continue
+			}
+			if buf[4] == cmdSynAck {
+				return nil
+			}
+			if buf[4] == cmdCookie && n == headSize+cookieSize {
+				// 带上cookie立即重发
+				copy(cookie, buf[headSize:n])
+				break
+			}
+		}
+	}
+	return ErrHandshakeTimeout
+}
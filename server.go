@@ -1,9 +1,19 @@
 package mynet
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net"
+	"sync"
+	"time"
 )
 
+var ErrServerClosed = errors.New("server closed")
+
+//DefaultHandshakeTimeout 默认的握手超时, 见 Server.SetHandshakeTimeout
+const DefaultHandshakeTimeout = 10 * time.Second
+
 //Handler 服务器处理连接Session的接口
 type Handler interface {
 	HandleSession(*Session)
@@ -26,6 +36,17 @@ type Server struct {
 	protocol     Protocol
 	handler      Handler
 	sendChanSize int
+
+	mutex       sync.Mutex            // 保护shutdown标记和handlerWait的计数
+	shutdown    bool                  // 是否已经开始关闭
+	handlerWait sync.WaitGroup        // 等待所有的HandleSession结束
+	handshakes  map[net.Conn]struct{} // 还在握手, 没有创建Session的连接
+
+	handshakeTimeout time.Duration // TLS和Codec握手的超时, 由mutex保护
+
+	admission    admission       // 连接的准入控制
+	interceptors []Interceptor   // 所有Session共用的拦截器, 由mutex保护
+	options      []SessionOption // 所有Session共用的配置, 由mutex保护
 }
 
 //NewServer 创建一个监听服务器
@@ -36,31 +57,177 @@ func NewServer(listener net.Listener, protocol Protocol, sendChanSize int, handl
 		protocol:     protocol,
 		handler:      handler,
 		sendChanSize: sendChanSize,
+
+		handshakeTimeout: DefaultHandshakeTimeout,
 	}
 }
 
+//Manager 获取管理所有Session的Manager
+func (s *Server) Manager() *Manager {
+	return s.manager
+}
+
 //Listener 获取监听的接口
 func (s *Server) Listener() net.Listener {
 	return s.listener
 }
 
+//Use 注册所有Session共用的拦截器, 只对之后创建的Session生效
+//单个Session的拦截器通过 Session.Use 追加在这些拦截器之后
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+//SetSessionOptions 追加所有Session共用的配置, 只对之后创建的Session生效
+func (s *Server) SetSessionOptions(opts ...SessionOption) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.options = append(s.options, opts...)
+}
+
+//SetHandshakeTimeout 设置TLS握手和 Protocol.NewCodec 的超时, 默认为 DefaultHandshakeTimeout, 0表示不限制
+//握手期间的连接也占用 SetMaxSessions 和 SetMaxSessionsPerIP 的名额, 超时后直接关闭
+func (s *Server) SetHandshakeTimeout(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handshakeTimeout = timeout
+}
+
 //Serve 处理连接
 func (s *Server) Serve() error {
 	for {
 		conn, err := Accept(s.Listener())
 		if err != nil {
+			if s.isShutdown() {
+				return ErrServerClosed
+			}
 			return err
 		}
 
+		// 准入检查在创建Codec之前, 不通过的连接直接关闭
+		release, err := s.admission.admit(conn.RemoteAddr())
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		s.mutex.Lock()
+		if s.shutdown {
+			s.mutex.Unlock()
+			conn.Close()
+			release()
+			return ErrServerClosed
+		}
+		s.handlerWait.Add(1)
+		if s.handshakes == nil {
+			s.handshakes = make(map[net.Conn]struct{})
+		}
+		s.handshakes[conn] = struct{}{}
+		var timeout = s.handshakeTimeout
+		s.mutex.Unlock()
+
 		go func() {
-			codec, err := s.protocol.NewCodec(conn)
+			defer s.handlerWait.Done()
+			if timeout > 0 {
+				conn.SetDeadline(time.Now().Add(timeout))
+			}
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				// 提前完成握手, 保证HandleSession中可以拿到对端的证书
+				if err := tlsConn.Handshake(); err != nil {
+					s.handshakeDone(conn)
+					conn.Close()
+					release()
+					return
+				}
+			}
+			var rw = newSessionConn(conn)
+			codec, err := s.protocol.NewCodec(rw)
 			if err != nil {
+				s.handshakeDone(conn)
 				conn.Close()
+				release()
+				return
+			}
+			if timeout > 0 {
+				conn.SetDeadline(time.Time{})
+			}
+
+			// 和Shutdown互斥, 保证Shutdown开始后不会再有新的Session加入
+			s.mutex.Lock()
+			delete(s.handshakes, conn)
+			if s.shutdown {
+				s.mutex.Unlock()
+				codec.Close()
+				release()
 				return
 			}
-			ses := s.manager.NewSession(codec, s.sendChanSize)
+			ses := s.manager.newConnSession(rw, s.protocol, codec, s.sendChanSize, s.options)
+			ses.Use(s.interceptors...)
+			s.mutex.Unlock()
+
+			// Session关闭后归还名额
+			ses.AddCloseCallback(s, &s.admission, func(error) { release() })
+			if ses.IsClosed() {
+				release()
+			}
+
 			s.handler.HandleSession(ses)
 		}()
 
 	}
 }
+
+//Shutdown 优雅的关闭服务器
+//停止接收新的连接, 等待每个Session发送完异步队列中的消息后关闭, 再等待所有的HandleSession返回.
+//还在进行TLS或者Codec握手的连接会被直接关闭
+//如果ctx先结束, 会强制关闭剩余的Session并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.shutdown {
+		s.mutex.Unlock()
+		return ErrServerClosed
+	}
+	s.shutdown = true
+	// 还在握手的连接完成握手后也会被丢弃, 直接关闭, 不需要等待对端
+	for conn := range s.handshakes {
+		conn.Close()
+	}
+	s.handshakes = nil
+	s.mutex.Unlock()
+
+	s.listener.Close()
+
+	s.manager.fetch(func(ses *Session) {
+		go ses.closeGraceful(ctx)
+	})
+
+	var done = make(chan struct{})
+	go func() {
+		s.handlerWait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.manager.Dispose()
+		return nil
+	case <-ctx.Done():
+		s.manager.Dispose()
+		return ctx.Err()
+	}
+}
+
+//handshakeDone 握手失败, 不再需要在Shutdown时关闭
+func (s *Server) handshakeDone(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.handshakes, conn)
+	s.mutex.Unlock()
+}
+
+func (s *Server) isShutdown() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.shutdown
+}
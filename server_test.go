@@ -0,0 +1,196 @@
+package mynet_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+)
+
+type serverMessage struct {
+	Seq int
+}
+
+func serverTestProtocol() *codec.JsonProtocol {
+	var protocol = codec.Json()
+	protocol.Register(serverMessage{})
+	return protocol
+}
+
+func TestServerShutdown(t *testing.T) {
+	const MsgNum = 100
+
+	var protocol = serverTestProtocol()
+	var received = make(chan struct{})
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", protocol, MsgNum, mynet.HandlerFunc(func(s *mynet.Session) {
+		if _, err := s.Receive(); err != nil {
+			t.Error(err)
+			return
+		}
+		for i := 0; i < MsgNum; i++ {
+			if err := s.Send(&serverMessage{Seq: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		close(received)
+		// 一直阻塞到Session被关闭
+		for {
+			if _, err := s.Receive(); err != nil {
+				return
+			}
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serveErr = make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve()
+	}()
+
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Send(&serverMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown error:%v", err)
+	}
+	if err = <-serveErr; err != mynet.ErrServerClosed {
+		t.Fatalf("serve should return ErrServerClosed, got %v", err)
+	}
+
+	// 关闭前队列里的消息都应该发送出来了
+	for i := 0; i < MsgNum; i++ {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatalf("receive %v error:%v", i, err)
+		}
+		if msg.(*serverMessage).Seq != i {
+			t.Fatalf("message %v not match: %v", i, msg)
+		}
+	}
+	if _, err = client.Receive(); err == nil {
+		t.Fatal("session should be closed by server")
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	var protocol = serverTestProtocol()
+	var block = make(chan struct{})
+	defer close(block)
+	var started = make(chan struct{})
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		close(started)
+		// 不响应关闭的Handler
+		<-block
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("shutdown should timeout, got %v", err)
+	}
+	// 剩余的Session被强制关闭
+	if _, err = client.Receive(); err == nil {
+		t.Fatal("session should be closed by server")
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	var protocol = serverTestProtocol()
+	var handled = make(chan *mynet.Session, 1)
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		handled <- s
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = mynet.DialContext(ctx, "tcp", server.Listener().Addr().String(), protocol, 0); err == nil {
+		t.Fatal("dial with canceled context should fail")
+	}
+
+	client, err := mynet.DialContext(context.Background(), "tcp", server.Listener().Addr().String(), protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var ses = <-handled
+	select {
+	case <-ses.Done():
+		t.Fatal("session should not be done")
+	default:
+	}
+	ses.Close()
+	<-ses.Done()
+	if ses.Context().Err() != context.Canceled {
+		t.Fatalf("session context should be canceled, got %v", ses.Context().Err())
+	}
+}
+
+//handshakeProtocol 在NewCodec中等待对端发送1字节, 模拟需要握手的协议
+type handshakeProtocol struct {
+	mynet.Protocol
+}
+
+func (p handshakeProtocol) NewCodec(rw io.ReadWriter) (mynet.Codec, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(rw, b[:]); err != nil {
+		return nil, err
+	}
+	return p.Protocol.NewCodec(rw)
+}
+
+func TestServerShutdownHandshake(t *testing.T) {
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", handshakeProtocol{serverTestProtocol()}, 0, mynet.HandlerFunc(func(s *mynet.Session) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	// 连接之后什么都不发送, 一直停留在握手阶段
+	conn, err := net.Dial("tcp", server.Listener().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown err = %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("handshaking conn should be closed, got %v", err)
+	}
+}
@@ -1,16 +1,41 @@
 package mynet
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
 	ErrSessionClosed  = errors.New("session closed")
 	ErrSessionBlocked = errors.New("session blocked")
+	ErrMessageDropped = errors.New("message dropped")
 )
 
+//OpError 读写连接出错导致Session关闭的原因
+type OpError struct {
+	Op  string // "read" 或者 "write"
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return "session " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+//atomic.Value 要求每次存储的类型一致, 所以包装一层
+type closeReason struct {
+	err error
+}
+
 var (
 	globalSessionId uint64
 )
@@ -19,24 +44,65 @@ var (
 type closeCallback struct {
 	Handler interface{}
 	Key     interface{}
-	Func    func()
+	Func    func(err error)
 	Next    *closeCallback
 }
 
 //Session 抽象的连接对象
 type Session struct {
+	// 原子操作的字段需要放在开头保证对齐
+	lastRecv    int64  // 最后一次收到消息的时间(UnixNano)
+	lastSend    int64  // 最后一次发出消息的时间(UnixNano)
+	messagesIn  uint64 // 收到的消息数
+	messagesOut uint64 // 发出的消息数
+	queuePeak   int64  // 异步发送队列长度的最大值
+
 	id       uint64           // 当前ses的id
 	codec    Codec            // 编码接口
+	protocol Protocol         // 创建codec的协议, 直接通过Codec创建时为nil
+	conn     net.Conn         // 底层的连接, 直接通过Codec创建时为nil
 	manager  *Manager         // 持有的管理器引用
 	sendChan chan interface{} // 异步的消息发送队列
+	sendDone chan struct{}    // 异步队列的发送协程退出通知
 
-	recvMutex sync.Mutex   // 数据接收锁
-	sendMutex sync.RWMutex // 数据发送锁
+	recvMutex  sync.Mutex   // 数据接收锁
+	sendMutex  sync.RWMutex // 数据发送锁
+	sendClosed bool         // sendChan 是否已经关闭, 由sendMutex保护
 
 	closeFlag  int32         // 关闭标记
+	closeErr   atomic.Value  // 关闭的原因 closeReason
 	closeChan  chan struct{} // 关闭通知
 	closeMutex sync.Mutex    // 关闭的锁
 
+	ctx    context.Context    // 生命周期和Session一致的上下文
+	cancel context.CancelFunc // Close 时取消ctx
+
+	interceptors atomic.Value // 消息拦截器 []Interceptor, 写时复制
+	useMutex     sync.Mutex   // 注册拦截器的锁
+
+	callSeq   uint32                     // Call的序号
+	callMutex sync.Mutex                 // 保护calls
+	calls     map[uint32]chan callResult // 等待回复的Call
+
+	pingInterval   time.Duration // Ping的间隔, 0表示不发送
+	pongTimeout    time.Duration // 等待Pong的超时
+	idleTimeout    time.Duration // 空闲超时, 0表示不检查
+	heartbeatMutex sync.Mutex    // 保护下面的心跳状态
+	pingSeq        uint32        // 最后一个Ping的序号
+	pingTime       time.Time     // 最后一个Ping的发送时间
+	waitPong       bool          // 是否在等待Pong
+	rtt            time.Duration // 平滑后的往返时间
+
+	backpressure Backpressure                      // 发送队列满了之后的策略
+	blockTimeout time.Duration                     // BackpressureBlockTimeout 的超时时间
+	onDrop       func(s *Session, msg interface{}) // 消息被丢弃的回调
+
+	sconn      *sessionConn  // 包装后的连接, 直接通过Codec创建时为nil
+	flushDelay time.Duration // 合并写入时额外等待的时间
+	flushSize  int           // 合并写入的大小阈值
+
+	logger Logger // 日志, 为nil时使用全局的日志
+
 	firstCloseCallback *closeCallback
 	lastCloseCallback  *closeCallback
 
@@ -44,37 +110,60 @@ type Session struct {
 }
 
 //NewSession 创建一个新的Session
-func NewSession(codec Codec, sendChanSize int) *Session {
-	return newSession(nil, codec, sendChanSize)
+func NewSession(codec Codec, sendChanSize int, opts ...SessionOption) *Session {
+	return newSession(nil, nil, nil, codec, sendChanSize, opts)
 }
 
-//newSession API的封装
-func newSession(m *Manager, codec Codec, sendChanSize int) *Session {
+//newSession API的封装. conn是sessionConn时, 会统计收发的字节数, 异步的发送协程会合并写入
+func newSession(m *Manager, conn net.Conn, protocol Protocol, codec Codec, sendChanSize int, opts []SessionOption) *Session {
 	var ses = &Session{
 		id:        atomic.AddUint64(&globalSessionId, 1),
 		codec:     codec,
+		protocol:  protocol,
+		conn:      conn,
 		manager:   m,
 		closeChan: make(chan struct{}),
+		lastRecv:  time.Now().UnixNano(),
+	}
+	if sconn, ok := conn.(*sessionConn); ok {
+		ses.sconn = sconn
+		ses.conn = sconn.Conn
+	}
+	ses.ctx, ses.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(ses)
 	}
 
 	if sendChanSize > 0 {
 		// 如果大于0, 说明通过chan启动一个异步的消息处理
 		ses.sendChan = make(chan interface{}, sendChanSize)
+		ses.sendDone = make(chan struct{})
 		go ses.sendLoop()
 
 	}
+	if ses.pingInterval > 0 || ses.idleTimeout > 0 {
+		go ses.heartbeatLoop()
+	}
+	ses.logf("session %d open", ses.id)
 	return ses
 }
 
 func (s *Session) sendLoop() {
+	defer close(s.sendDone)
 	for {
-		//TODO 返回原因的log
 		select {
 		case msg, ok := <-s.sendChan:
 			if !ok {
 				return
 			}
-			if err := s.codec.Send(msg); err != nil {
+			var err error
+			if s.sconn != nil {
+				err = s.sendBatch(msg)
+			} else {
+				err = s.encode(msg)
+			}
+			if err != nil {
+				s.CloseWithError(&OpError{Op: "write", Err: err})
 				return
 			}
 		case <-s.closeChan:
@@ -83,7 +172,20 @@ func (s *Session) sendLoop() {
 	}
 }
 
+//ID 返回Session的唯一ID, 可以用 Manager.Get 查找
+func (s *Session) ID() uint64 {
+	return s.id
+}
+
+//Send 发送一条消息. 异步的Session只是放入发送队列, 队列满了之后按照 WithBackpressure 设置的策略处理
 func (s *Session) Send(msg interface{}) error {
+	if interceptors := s.loadInterceptors(); len(interceptors) > 0 {
+		return chainSend(s, interceptors, s.send)(msg)
+	}
+	return s.send(msg)
+}
+
+func (s *Session) send(msg interface{}) error {
 	if s.sendChan == nil {
 		// 非异步的Session
 		if s.IsClosed() {
@@ -92,57 +194,216 @@ func (s *Session) Send(msg interface{}) error {
 
 		s.sendMutex.Lock()
 		defer s.sendMutex.Unlock()
-		err := s.codec.Send(msg)
+		err := s.encode(msg)
 		if err != nil {
-			s.Close()
+			s.CloseWithError(&OpError{Op: "write", Err: err})
 		}
 		return err
 	}
 
 	// 使用异步chan 需要保证chan是可用的
 	s.sendMutex.RLock()
-	defer s.sendMutex.RUnlock()
-	if s.IsClosed() {
+	if s.IsClosed() || s.sendClosed {
+		s.sendMutex.RUnlock()
 		return ErrSessionClosed
 	}
 
 	select {
 	case s.sendChan <- msg:
+		s.sendMutex.RUnlock()
+		s.queued()
 		return nil
 	default:
-		s.Close()
+	}
+
+	if s.backpressure == BackpressureClose {
+		// 先释放读锁, Close中需要获取写锁
+		s.sendMutex.RUnlock()
+		s.CloseWithError(ErrSessionBlocked)
 		return ErrSessionBlocked
 	}
+	defer s.sendMutex.RUnlock()
+	return s.sendBlocked(msg)
+}
+
+//sendBlocked 按照策略处理队列满了的情况, 需要在外边持有sendMutex的读锁
+//阻塞时同时等待closeChan, Close会先关闭closeChan再获取写锁
+func (s *Session) sendBlocked(msg interface{}) error {
+	switch s.backpressure {
+	case BackpressureBlock:
+		select {
+		case s.sendChan <- msg:
+			s.queued()
+			return nil
+		case <-s.closeChan:
+			return ErrSessionClosed
+		}
+	case BackpressureBlockTimeout:
+		var timer = time.NewTimer(s.blockTimeout)
+		defer timer.Stop()
+		select {
+		case s.sendChan <- msg:
+			s.queued()
+			return nil
+		case <-s.closeChan:
+			return ErrSessionClosed
+		case <-timer.C:
+			s.drop(msg)
+			return ErrMessageDropped
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case s.sendChan <- msg:
+				s.queued()
+				return nil
+			default:
+			}
+			select {
+			case old := <-s.sendChan:
+				s.drop(old)
+			default:
+				// 发送协程刚好取走了消息, 重新尝试
+			}
+		}
+	default:
+		s.drop(msg)
+		return ErrMessageDropped
+	}
+}
+
+func (s *Session) drop(msg interface{}) {
+	if s.onDrop != nil {
+		s.onDrop(s, msg)
+	}
 }
 
 //Receive 接收一条数据
 func (s *Session) Receive() (interface{}, error) {
 	s.recvMutex.Lock()
 	defer s.recvMutex.Unlock()
+	var receive ReceiveFunc = s.receive
+	if interceptors := s.loadInterceptors(); len(interceptors) > 0 {
+		receive = chainReceive(s, interceptors, receive)
+	}
+	for {
+		msg, err := receive()
+		if err != nil {
+			return msg, err
+		}
+		// Call的回复和心跳在内部处理掉
+		if s.dispatchCall(msg) || s.handleHeartbeat(msg) {
+			continue
+		}
+		return msg, nil
+	}
+}
+
+func (s *Session) receive() (interface{}, error) {
 	msg, err := s.codec.Receive()
 	if err != nil {
-		s.Close()
+		s.CloseWithError(&OpError{Op: "read", Err: err})
+		return msg, err
 	}
+	atomic.StoreInt64(&s.lastRecv, time.Now().UnixNano())
+	atomic.AddUint64(&s.messagesIn, 1)
 	return msg, err
 }
 
+//Use 为当前Session注册拦截器, 追加在已有的拦截器之后
+func (s *Session) Use(interceptors ...Interceptor) {
+	s.useMutex.Lock()
+	defer s.useMutex.Unlock()
+	var old = s.loadInterceptors()
+	var chain = make([]Interceptor, 0, len(old)+len(interceptors))
+	chain = append(chain, old...)
+	chain = append(chain, interceptors...)
+	s.interceptors.Store(chain)
+}
+
+func (s *Session) loadInterceptors() []Interceptor {
+	interceptors, _ := s.interceptors.Load().([]Interceptor)
+	return interceptors
+}
+
+//Context 返回和Session生命周期一致的上下文, Session关闭时会被取消
+//可以用来控制由Session派生出的请求
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+//Done 返回Session的关闭通知, Session关闭后这个chan会被关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.closeChan
+}
+
+//Conn 返回Session底层的连接, 通过NewSession直接创建的Session返回nil
+func (s *Session) Conn() net.Conn {
+	return s.conn
+}
+
+//ConnectionState 返回TLS连接的状态, 底层不是TLS连接时ok为false
+func (s *Session) ConnectionState() (state tls.ConnectionState, ok bool) {
+	var conn = s.conn
+	for conn != nil {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			return c.ConnectionState(), true
+		case interface{ netConn() net.Conn }:
+			// 包装过的连接(如websocket), 继续向下查找
+			conn = c.netConn()
+		default:
+			return state, false
+		}
+	}
+	return state, false
+}
+
+//VerifiedChains 返回对端经过验证的证书链, 可以用来做mTLS的身份认证
+//非TLS连接或者没有验证对端证书时返回nil
+func (s *Session) VerifiedChains() [][]*x509.Certificate {
+	state, ok := s.ConnectionState()
+	if !ok {
+		return nil
+	}
+	return state.VerifiedChains
+}
+
 //IsClosed 当前Session是否已经关闭
 func (s *Session) IsClosed() bool {
 	return atomic.LoadInt32(&s.closeFlag) == 1
 }
 
-//Close 关闭当前Session
+//Err 返回Session关闭的原因, 没有关闭时返回nil
+//直接调用Close关闭时为 ErrSessionClosed, 读写出错时为 *OpError, 其他的原因如 ErrSessionBlocked, ErrServerClosed
+func (s *Session) Err() error {
+	reason, _ := s.closeErr.Load().(closeReason)
+	return reason.err
+}
+
+//Close 关闭当前Session, 关闭原因为 ErrSessionClosed
 func (s *Session) Close() error {
+	return s.CloseWithError(ErrSessionClosed)
+}
+
+//CloseWithError 关闭当前Session并记录原因. 只有第一次关闭的原因会被记录
+func (s *Session) CloseWithError(err error) error {
+	if err == nil {
+		err = ErrSessionClosed
+	}
 	if !atomic.CompareAndSwapInt32(&s.closeFlag, 0, 1) {
 		return ErrSessionClosed
 	}
 
+	s.closeErr.Store(closeReason{err})
+	s.logf("session %d closed: %v", s.id, err)
 	close(s.closeChan)
+	s.cancel()
 
 	if s.sendChan != nil {
 		// 这个关闭应该也不是必须的.
 		s.sendMutex.Lock()
-		close(s.sendChan)
+		s.closeSendChan()
 		s.sendMutex.Unlock()
 
 		// 是否有必要释放chan中的消息?
@@ -161,13 +422,34 @@ func (s *Session) Close() error {
 		}
 	}()
 
-	err := s.codec.Close()
+	return s.codec.Close()
+}
 
-	return err
+//closeSendChan 关闭异步队列, 需要在外边持有sendMutex的写锁
+func (s *Session) closeSendChan() {
+	if !s.sendClosed {
+		s.sendClosed = true
+		close(s.sendChan)
+	}
+}
+
+//closeGraceful 不再接收新的消息, 等待异步队列中的消息发送完毕(或者ctx结束)后关闭
+func (s *Session) closeGraceful(ctx context.Context) {
+	if s.sendChan != nil {
+		s.sendMutex.Lock()
+		s.closeSendChan()
+		s.sendMutex.Unlock()
+
+		select {
+		case <-s.sendDone:
+		case <-ctx.Done():
+		}
+	}
+	s.CloseWithError(ErrServerClosed)
 }
 
-//AddCloseCallback 注册关闭回调函数
-func (s *Session) AddCloseCallback(handler, key interface{}, callback func()) {
+//AddCloseCallback 注册关闭回调函数, 回调的参数是关闭的原因
+func (s *Session) AddCloseCallback(handler, key interface{}, callback func(err error)) {
 	if s.IsClosed() {
 		return
 	}
@@ -219,7 +501,8 @@ func (s *Session) invokeCloseCallbacks() {
 	s.closeMutex.Lock()
 	defer s.closeMutex.Unlock()
 
+	var err = s.Err()
 	for callback := s.firstCloseCallback; callback != nil; callback = callback.Next {
-		callback.Func()
+		callback.Func(err)
 	}
 }
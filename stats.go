@@ -0,0 +1,114 @@
+package mynet
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//SessionStats Session的流量统计
+type SessionStats struct {
+	MessagesIn  uint64    // 收到的消息数, 不包括内部处理掉的心跳和Call的回复
+	MessagesOut uint64    // 发出的消息数
+	BytesIn     uint64    // 收到的字节数, 只统计基于连接创建的Session
+	BytesOut    uint64    // 发出的字节数, 只统计基于连接创建的Session
+	QueueLen    int       // 异步发送队列中当前的消息数
+	QueuePeak   int       // 异步发送队列长度的最大值
+	LastRead    time.Time // 最后一次收到消息的时间
+	LastWrite   time.Time // 最后一次发出消息的时间
+}
+
+//ManagerStats Manager中所有Session的汇总统计
+//消息数和字节数包括已经关闭的Session, QueueLen只统计当前的Session, QueuePeak和时间取最大值
+type ManagerStats struct {
+	Sessions int // 当前的Session数
+	SessionStats
+}
+
+//Stats 返回当前Session的统计, 各个字段分别原子读取, 相互之间不保证一致
+func (s *Session) Stats() SessionStats {
+	var stats = SessionStats{
+		MessagesIn:  atomic.LoadUint64(&s.messagesIn),
+		MessagesOut: atomic.LoadUint64(&s.messagesOut),
+		QueueLen:    len(s.sendChan),
+		QueuePeak:   int(atomic.LoadInt64(&s.queuePeak)),
+	}
+	if s.sconn != nil {
+		stats.BytesIn = atomic.LoadUint64(&s.sconn.bytesIn)
+		stats.BytesOut = atomic.LoadUint64(&s.sconn.bytesOut)
+	}
+	if stats.MessagesIn > 0 {
+		stats.LastRead = time.Unix(0, atomic.LoadInt64(&s.lastRecv))
+	}
+	if last := atomic.LoadInt64(&s.lastSend); last > 0 {
+		stats.LastWrite = time.Unix(0, last)
+	}
+	return stats
+}
+
+//encode 通过Codec发送一条消息并统计. Codec不能处理 *Encoded 时发送原始的消息
+func (s *Session) encode(msg interface{}) error {
+	if e, ok := msg.(*Encoded); ok && !writesEncoded(s.protocol) {
+		msg = e.Msg
+	}
+	if err := s.codec.Send(msg); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&s.lastSend, time.Now().UnixNano())
+	atomic.AddUint64(&s.messagesOut, 1)
+	return nil
+}
+
+//queued 消息放入异步队列后更新队列长度的最大值
+func (s *Session) queued() {
+	var n = int64(len(s.sendChan))
+	for {
+		var peak = atomic.LoadInt64(&s.queuePeak)
+		if n <= peak || atomic.CompareAndSwapInt64(&s.queuePeak, peak, n) {
+			return
+		}
+	}
+}
+
+//Stats 汇总所有Session的统计
+func (m *Manager) Stats() ManagerStats {
+	var stats ManagerStats
+	m.statsMutex.Lock()
+	stats.SessionStats = m.closed
+	m.statsMutex.Unlock()
+
+	m.fetch(func(ses *Session) {
+		stats.Sessions++
+		mergeStats(&stats.SessionStats, ses.Stats())
+	})
+	return stats
+}
+
+func (m *Manager) addClosedStats(s SessionStats) {
+	// 当前的队列长度只统计还存在的Session
+	s.QueueLen = 0
+	m.statsMutex.Lock()
+	mergeStats(&m.closed, s)
+	m.statsMutex.Unlock()
+}
+
+func mergeStats(total *SessionStats, s SessionStats) {
+	total.MessagesIn += s.MessagesIn
+	total.MessagesOut += s.MessagesOut
+	total.BytesIn += s.BytesIn
+	total.BytesOut += s.BytesOut
+	total.QueueLen += s.QueueLen
+	if s.QueuePeak > total.QueuePeak {
+		total.QueuePeak = s.QueuePeak
+	}
+	if s.LastRead.After(total.LastRead) {
+		total.LastRead = s.LastRead
+	}
+	if s.LastWrite.After(total.LastWrite) {
+		total.LastWrite = s.LastWrite
+	}
+}
+
+//Stats 汇总服务器上所有Session的统计
+func (s *Server) Stats() ManagerStats {
+	return s.manager.Stats()
+}
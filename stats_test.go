@@ -0,0 +1,62 @@
+package mynet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+func TestStats(t *testing.T) {
+	const total = 10
+	server, err := mynet.Listen("tcp", "127.0.0.1:0", serverTestProtocol(), 0, echoHandler(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	client, err := mynet.Dial("tcp", server.Listener().Addr().String(), serverTestProtocol(), total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < total; i++ {
+		if err = client.Send(&serverMessage{Seq: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < total; i++ {
+		if _, err = client.Receive(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats = client.Stats()
+	if stats.MessagesIn != total || stats.MessagesOut != total {
+		t.Fatalf("messages not match: %+v", stats)
+	}
+	if stats.BytesIn == 0 || stats.BytesIn != stats.BytesOut {
+		t.Fatalf("bytes not match: %+v", stats)
+	}
+	if stats.LastRead.IsZero() || stats.LastWrite.IsZero() {
+		t.Fatalf("time not recorded: %+v", stats)
+	}
+
+	var serverStats = server.Stats()
+	if serverStats.Sessions != 1 || serverStats.MessagesIn != total || serverStats.BytesOut != stats.BytesIn {
+		t.Fatalf("server stats not match: %+v", serverStats)
+	}
+
+	// 关闭的Session仍然计入汇总
+	client.Close()
+	var deadline = time.Now().Add(time.Second)
+	for server.Stats().Sessions != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server session not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if closed := server.Stats(); closed.MessagesOut != total || closed.BytesIn != stats.BytesOut {
+		t.Fatalf("closed stats not match: %+v", closed)
+	}
+}
@@ -30,16 +30,14 @@ func main() {
 	json.Register(1, &demo.Req{})
 	json.Register(2, &demo.Rsp{})
 
-	server, err := mynet.Listen("tcp", "0.0.0.0:0", json, 0, mynet.HandlerFunc(func(s *mynet.Session) {
-		for {
-			req, err := s.Receive()
-			checkErr(err)
-
-			checkErr(s.Send(&demo.Rsp{
-				Str: req.(*demo.Req).GetStr(),
-			}))
-		}
-	}))
+	router := mynet.NewRouter()
+	router.Handle(&demo.Req{}, func(s *mynet.Session, req interface{}) error {
+		return s.Send(&demo.Rsp{
+			Str: req.(*demo.Req).GetStr(),
+		})
+	})
+
+	server, err := mynet.Listen("tcp", "0.0.0.0:0", json, 0, router)
 	checkErr(err)
 
 	go server.Serve()
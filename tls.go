@@ -0,0 +1,25 @@
+package mynet
+
+import (
+	"crypto/tls"
+)
+
+//ListenTLS 创建一个TLS监听的服务器
+//需要验证客户端证书(mTLS)时, 设置 config.ClientAuth 和 config.ClientCAs, 然后在Handler中通过 Session.VerifiedChains 获取客户端身份
+func ListenTLS(network, addr string, config *tls.Config, protocol Protocol, sendChanSize int, handler Handler) (*Server, error) {
+	listener, err := tls.Listen(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(listener, protocol, sendChanSize, handler), nil
+}
+
+//DialTLS 连接一个TLS接口的服务器, 返回时已经完成了握手
+func DialTLS(network, addr string, config *tls.Config, protocol Protocol, sendChanSize int, opts ...SessionOption) (*Session, error) {
+	conn, err := tls.Dial(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return newClientSession(conn, protocol, sendChanSize, opts)
+}
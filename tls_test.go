@@ -0,0 +1,121 @@
+package mynet_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+)
+
+//testCert 本地生成的证书, parent为nil时生成自签名的CA
+func testCert(t *testing.T, name string, parent *tls.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	var parentCert, parentKey = template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parentCert = parent.Leaf
+		parentKey = parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestMutualTLS(t *testing.T) {
+	var ca = testCert(t, "ca", nil, x509.ExtKeyUsageAny)
+	var serverCert = testCert(t, "server", &ca, x509.ExtKeyUsageServerAuth)
+	var clientCert = testCert(t, "client", &ca, x509.ExtKeyUsageClientAuth)
+	var pool = x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	var serverConfig = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	var identity = make(chan string, 1)
+	var protocol = serverTestProtocol()
+	server, err := mynet.ListenTLS("tcp", "127.0.0.1:0", serverConfig, protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		var chains = s.VerifiedChains()
+		if len(chains) == 0 {
+			identity <- ""
+			return
+		}
+		identity <- chains[0][0].Subject.CommonName
+		msg, err := s.Receive()
+		if err != nil {
+			return
+		}
+		s.Send(msg)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	var addr = server.Listener().Addr().String()
+	client, err := mynet.DialTLS("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      pool,
+	}, protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if name := <-identity; name != "client" {
+		t.Fatalf("client identity not match: %q", name)
+	}
+	if state, ok := client.ConnectionState(); !ok || state.PeerCertificates[0].Subject.CommonName != "server" {
+		t.Fatal("server certificate not match")
+	}
+	if err = client.Send(&serverMessage{Seq: 1}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := client.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.(*serverMessage).Seq != 1 {
+		t.Fatalf("message not match: %v", msg)
+	}
+
+	// 没有客户端证书的连接会在握手时被拒绝
+	noCert, err := mynet.DialTLS("tcp", addr, &tls.Config{RootCAs: pool}, protocol, 0)
+	if err == nil {
+		if _, err = noCert.Receive(); err == nil {
+			t.Fatal("connection without client certificate should be rejected")
+		}
+	}
+}
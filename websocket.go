@@ -0,0 +1,549 @@
+package mynet
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWebSocketHandshake = errors.New("websocket handshake error")
+	ErrWebSocketFrame     = errors.New("websocket frame error")
+	ErrWebSocketTooLarge  = errors.New("websocket message too large")
+)
+
+//websocket 帧的操作码
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// 握手时用来计算 Sec-WebSocket-Accept 的固定GUID
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+//wsCloseTimeout 关闭时发送关闭帧的超时时间, 对端不读取时不会一直阻塞
+const wsCloseTimeout = time.Second
+
+//wsMaxHeaderBytes 升级请求头部的最大长度
+const wsMaxHeaderBytes = 8 << 10
+
+//DefaultWebSocketMessageSize 默认的单条消息最大长度, 见 WebSocketConfig.MaxMessageSize
+const DefaultWebSocketMessageSize = 1 << 20
+
+//WebSocketConfig websocket 的相关配置, 为nil时全部使用默认值
+type WebSocketConfig struct {
+	Path           string                     // 服务器监听的路径, 默认为 "/"
+	TextFrame      bool                       // 发送时使用文本帧, 默认使用二进制帧
+	MaxMessageSize int64                      // 单条消息的最大长度, 0表示 DefaultWebSocketMessageSize
+	CheckOrigin    func(r *http.Request) bool // 服务器校验请求来源, 为nil时不校验
+	Header         http.Header                // 客户端握手时附加的请求头
+	TLSConfig      *tls.Config                // 客户端使用 wss 连接时的配置
+
+	// 握手的超时时间, 0表示 DefaultHandshakeTimeout
+	// 服务器在交给 Server.Serve 之前完成升级, 这个超时限制了读取升级请求和空闲的HTTP连接
+	HandshakeTimeout time.Duration
+}
+
+func (c *WebSocketConfig) path() string {
+	if c == nil || c.Path == "" {
+		return "/"
+	}
+	return c.Path
+}
+
+func (c *WebSocketConfig) textFrame() bool {
+	return c != nil && c.TextFrame
+}
+
+func (c *WebSocketConfig) maxMessageSize() int64 {
+	if c == nil || c.MaxMessageSize <= 0 {
+		return DefaultWebSocketMessageSize
+	}
+	return c.MaxMessageSize
+}
+
+func (c *WebSocketConfig) handshakeTimeout() time.Duration {
+	if c == nil || c.HandshakeTimeout <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return c.HandshakeTimeout
+}
+
+//ListenWebSocket 创建一个基于websocket的服务器
+//每一个websocket消息都对应一次 Codec.Receive/Send, 所以不需要额外的分包处理
+func ListenWebSocket(network, addr string, config *WebSocketConfig, protocol Protocol, sendChanSize int, handler Handler) (*Server, error) {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(NewWebSocketListener(listener, config), protocol, sendChanSize, handler), nil
+}
+
+//DialWebSocket 连接一个websocket服务器, rawurl 的格式为 ws://host:port/path 或者 wss://host:port/path
+func DialWebSocket(rawurl string, config *WebSocketConfig, protocol Protocol, sendChanSize int, opts ...SessionOption) (*Session, error) {
+	conn, err := dialWebSocket(rawurl, config)
+	if err != nil {
+		return nil, err
+	}
+	return newClientSession(conn, protocol, sendChanSize, opts)
+}
+
+//wsListener 将http升级后的websocket连接包装成net.Listener
+type wsListener struct {
+	listener  net.Listener
+	server    *http.Server
+	config    *WebSocketConfig
+	connChan  chan net.Conn
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+//NewWebSocketListener 在一个已有的监听上处理websocket的握手, 返回的Listener只会Accept握手成功的连接
+//没有在握手超时内发送完升级请求的连接, 和头部超过限制的请求都会被http.Server关闭
+func NewWebSocketListener(listener net.Listener, config *WebSocketConfig) net.Listener {
+	var l = &wsListener{
+		listener:  listener,
+		config:    config,
+		connChan:  make(chan net.Conn),
+		closeChan: make(chan struct{}),
+	}
+	var mux = http.NewServeMux()
+	mux.Handle(config.path(), l)
+	l.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: config.handshakeTimeout(),
+		IdleTimeout:       config.handshakeTimeout(),
+		MaxHeaderBytes:    wsMaxHeaderBytes,
+	}
+	go l.server.Serve(listener)
+	return l
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connChan:
+		return conn, nil
+	case <-l.closeChan:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *wsListener) Close() error {
+	var err = net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.closeChan)
+		// 已经升级的连接被Hijack了, 不会受到影响
+		err = l.server.Close()
+	})
+	return err
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+//ServeHTTP 处理websocket的升级请求
+func (l *wsListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket: not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return
+	}
+	var key = r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "websocket: missing key", http.StatusBadRequest)
+		return
+	}
+	if l.config != nil && l.config.CheckOrigin != nil && !l.config.CheckOrigin(r) {
+		http.Error(w, "websocket: origin not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: hijack not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	var resp = "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(l.config.handshakeTimeout()))
+	if _, err = conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return
+	}
+	// 升级完成, 清除握手时的超时
+	conn.SetDeadline(time.Time{})
+
+	// 客户端可能紧跟着握手发送了数据, 所以要沿用Hijack返回的缓冲区
+	var ws = newWSConn(conn, brw.Reader, false, l.config)
+	select {
+	case l.connChan <- ws:
+	case <-l.closeChan:
+		ws.Close()
+	}
+}
+
+//dialWebSocket 建立连接并完成客户端的握手
+func dialWebSocket(rawurl string, config *WebSocketConfig) (net.Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = net.Dial("tcp", hostWithPort(u, "80"))
+	case "wss":
+		var tlsConfig = &tls.Config{}
+		if config != nil && config.TLSConfig != nil {
+			tlsConfig = config.TLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn, err = tls.Dial("tcp", hostWithPort(u, "443"), tlsConfig)
+	default:
+		return nil, ErrWebSocketHandshake
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(config.handshakeTimeout()))
+	ws, err := clientHandshake(conn, u, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+func clientHandshake(conn net.Conn, u *url.URL, config *WebSocketConfig) (*wsConn, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	var key = base64.StdEncoding.EncodeToString(nonce[:])
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		for k, v := range config.Header {
+			req.Header[k] = v
+		}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err = req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	var br = bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContains(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, ErrWebSocketHandshake
+	}
+	return newWSConn(conn, br, true, config), nil
+}
+
+//wsConn 基于websocket帧的net.Conn
+//每次Write都会发送一个完整的消息, Read则按顺序读出消息的内容
+type wsConn struct {
+	net.Conn
+	br      *bufio.Reader
+	client  bool // 客户端发送的帧需要mask
+	opcode  byte // 发送消息使用的帧类型
+	maxSize int64
+
+	// 以下字段只在Read中使用
+	remain     int64   // 当前帧剩余未读的长度
+	msgSize    int64   // 当前消息已读的长度
+	masked     bool    // 当前帧是否带有mask
+	maskKey    [4]byte // 当前帧的mask
+	maskPos    int     // mask的偏移
+	fragmented bool    // 当前消息是否还有后续的分片
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, client bool, config *WebSocketConfig) *wsConn {
+	var ws = &wsConn{
+		Conn:    conn,
+		br:      br,
+		client:  client,
+		opcode:  wsOpBinary,
+		maxSize: config.maxMessageSize(),
+	}
+	if config.textFrame() {
+		ws.opcode = wsOpText
+	}
+	return ws
+}
+
+//Read 读取消息的内容, 控制帧会在内部处理掉
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remain == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remain {
+		p = p[:c.remain]
+	}
+	n, err := c.br.Read(p)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			p[i] ^= c.maskKey[(c.maskPos+i)&3]
+		}
+		c.maskPos = (c.maskPos + n) & 3
+	}
+	c.remain -= int64(n)
+	return n, err
+}
+
+//nextFrame 读取下一个数据帧的头部
+func (c *wsConn) nextFrame() error {
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.br, head[:]); err != nil {
+			return err
+		}
+		var (
+			final  = head[0]&0x80 != 0
+			opcode = head[0] & 0x0F
+			masked = head[1]&0x80 != 0
+			length = int64(head[1] & 0x7F)
+		)
+		// 没有协商扩展, RSV位必须是0; 服务器收到的帧必须mask, 客户端收到的帧必须没有mask
+		if head[0]&0x70 != 0 || masked == c.client {
+			return ErrWebSocketFrame
+		}
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint64(ext[:]))
+			if length < 0 {
+				return ErrWebSocketFrame
+			}
+		}
+		c.masked = masked
+		c.maskPos = 0
+		if masked {
+			if _, err := io.ReadFull(c.br, c.maskKey[:]); err != nil {
+				return err
+			}
+		}
+
+		switch opcode {
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			if (opcode == wsOpContinuation) != c.fragmented {
+				return ErrWebSocketFrame
+			}
+			if opcode != wsOpContinuation {
+				c.msgSize = 0
+			}
+			c.msgSize += length
+			if c.maxSize > 0 && c.msgSize > c.maxSize {
+				return ErrWebSocketTooLarge
+			}
+			c.fragmented = !final
+			c.remain = length
+			return nil
+		case wsOpClose, wsOpPing, wsOpPong:
+			if !final || length > 125 {
+				return ErrWebSocketFrame
+			}
+			var payload = make([]byte, length)
+			if _, err := io.ReadFull(c.br, payload); err != nil {
+				return err
+			}
+			if masked {
+				for i := range payload {
+					payload[i] ^= c.maskKey[i&3]
+				}
+			}
+			switch opcode {
+			case wsOpPing:
+				if err := c.writeFrame(wsOpPong, payload); err != nil {
+					return err
+				}
+			case wsOpClose:
+				c.Close()
+				return io.EOF
+			}
+		default:
+			return ErrWebSocketFrame
+		}
+	}
+}
+
+//Write 每次调用都会发送一个完整的消息
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(c.opcode, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame, err := c.appendFrame(make([]byte, 0, len(payload)+14), opcode, payload)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.Conn.Write(frame)
+	return err
+}
+
+//writeMessages 每条消息一个帧, 所有的帧一次写入
+func (c *wsConn) writeMessages(msgs net.Buffers) error {
+	var size int
+	for _, msg := range msgs {
+		size += len(msg) + 14
+	}
+	var frames = make([]byte, 0, size)
+	for _, msg := range msgs {
+		var err error
+		if frames, err = c.appendFrame(frames, c.opcode, msg); err != nil {
+			return err
+		}
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.Conn.Write(frames)
+	return err
+}
+
+//appendFrame 把一个完整的帧追加到frame之后
+func (c *wsConn) appendFrame(frame []byte, opcode byte, payload []byte) ([]byte, error) {
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		var ext [2]byte
+		binary.BigEndian.PutUint16(ext[:], uint16(n))
+		frame = append(frame, maskBit|126)
+		frame = append(frame, ext[:]...)
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, ext[:]...)
+	}
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return frame, err
+		}
+		frame = append(frame, key[:]...)
+		var start = len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= key[i&3]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	return frame, nil
+}
+
+//netConn 返回被包装的连接
+func (c *wsConn) netConn() net.Conn {
+	return c.Conn
+}
+
+//Close 尽量通知对端后关闭连接
+func (c *wsConn) Close() error {
+	var err = net.ErrClosed
+	c.closeOnce.Do(func() {
+		// 写超时同样作用于正在阻塞的Write, 对端不读取时Write返回后才能拿到writeMutex
+		c.Conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+		// 1000: 正常关闭
+		c.writeFrame(wsOpClose, []byte{0x03, 0xE8})
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func wsAcceptKey(key string) string {
+	var h = sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//headerContains 头部字段中是否包含指定的token(忽略大小写)
+func headerContains(header http.Header, name, token string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
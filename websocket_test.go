@@ -0,0 +1,226 @@
+package mynet_test
+
+import (
+	"bufio"
+	"errors"
+	"mynet/proto/demo"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ganyyy/mynet"
+	"github.com/ganyyy/mynet/codec"
+)
+
+type wsMessage struct {
+	Field1 string
+	Field2 int
+}
+
+func echoHandler(t *testing.T) mynet.Handler {
+	return mynet.HandlerFunc(func(s *mynet.Session) {
+		for {
+			msg, err := s.Receive()
+			if err != nil {
+				return
+			}
+			if err = s.Send(msg); err != nil {
+				t.Errorf("echo send error:%v", err)
+				return
+			}
+		}
+	})
+}
+
+func wsEcho(t *testing.T, config *mynet.WebSocketConfig, protocol mynet.Protocol, msgs ...interface{}) []interface{} {
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", config, protocol, 0, echoHandler(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	var path = "/"
+	if config != nil && config.Path != "" {
+		path = config.Path
+	}
+	client, err := mynet.DialWebSocket("ws://"+server.Listener().Addr().String()+path, config, protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var rsp []interface{}
+	for _, msg := range msgs {
+		if err = client.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		recv, err := client.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp = append(rsp, recv)
+	}
+	return rsp
+}
+
+func TestWebSocketJson(t *testing.T) {
+	var protocol = codec.Json()
+	protocol.Register(wsMessage{})
+
+	var config = &mynet.WebSocketConfig{Path: "/ws", TextFrame: true}
+	var msgs = []interface{}{
+		&wsMessage{Field1: "hello", Field2: 1},
+		// 超过125字节, 使用扩展长度
+		&wsMessage{Field1: strings.Repeat("a", 1000), Field2: 2},
+		// 超过65535字节, 使用8字节的扩展长度
+		&wsMessage{Field1: strings.Repeat("b", 70000), Field2: 3},
+	}
+	var rsp = wsEcho(t, config, protocol, msgs...)
+	for i, msg := range msgs {
+		if *rsp[i].(*wsMessage) != *msg.(*wsMessage) {
+			t.Fatalf("message %v not match", i)
+		}
+	}
+}
+
+func TestWebSocketPB(t *testing.T) {
+	var protocol = codec.PBProtocol()
+	protocol.Register(1, &demo.Req{})
+
+	var rsp = wsEcho(t, nil, protocol, &demo.Req{Str: "hello"}, &demo.Req{Str: "world"})
+	if rsp[0].(*demo.Req).GetStr() != "hello" || rsp[1].(*demo.Req).GetStr() != "world" {
+		t.Fatalf("message not match: %v", rsp)
+	}
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", &mynet.WebSocketConfig{Path: "/ws"}, codec.Json(), 0, echoHandler(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	_, err = mynet.DialWebSocket("ws://"+server.Listener().Addr().String()+"/other", nil, codec.Json(), 0)
+	if err != mynet.ErrWebSocketHandshake {
+		t.Fatalf("expect handshake error, got %v", err)
+	}
+}
+
+func TestWebSocketCloseStuckPeer(t *testing.T) {
+	var protocol = codec.Json()
+	protocol.Register(wsMessage{})
+
+	var sessions = make(chan *mynet.Session, 1)
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", nil, protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		sessions <- s
+		s.Receive()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	// 客户端从不读取
+	client, err := mynet.DialWebSocket("ws://"+server.Listener().Addr().String(), nil, protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var ses = <-sessions
+
+	var msg = &wsMessage{Field1: strings.Repeat("x", 1<<19)}
+	var sendDone = make(chan struct{})
+	go func() {
+		defer close(sendDone)
+		for ses.Send(msg) == nil {
+		}
+	}()
+	// 等待发送阻塞在写连接上
+	time.Sleep(200 * time.Millisecond)
+
+	var closed = make(chan struct{})
+	go func() {
+		ses.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("close blocked by a stuck write")
+	}
+	<-sendDone
+}
+
+func TestWebSocketHandshakeLimit(t *testing.T) {
+	var config = &mynet.WebSocketConfig{HandshakeTimeout: 100 * time.Millisecond}
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", config, codec.Json(), 0, echoHandler(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+	var addr = server.Listener().Addr().String()
+
+	// 不发送升级请求的连接在握手超时后被关闭
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idle.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = idle.Read(make([]byte, 1)); err == nil {
+		t.Fatal("idle connection not closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("idle connection not closed before the deadline")
+	}
+
+	// 头部过大的请求被拒绝
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+	req.Header.Set("X-Padding", strings.Repeat("a", 64<<10))
+	go req.Write(conn)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("status = %v", resp.Status)
+	}
+}
+
+func TestWebSocketDefaultMaxMessageSize(t *testing.T) {
+	var protocol = codec.Json()
+	protocol.Register(wsMessage{})
+
+	var errChan = make(chan error, 1)
+	server, err := mynet.ListenWebSocket("tcp", "127.0.0.1:0", nil, protocol, 0, mynet.HandlerFunc(func(s *mynet.Session) {
+		_, err := s.Receive()
+		errChan <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Listener().Close()
+
+	client, err := mynet.DialWebSocket("ws://"+server.Listener().Addr().String(), nil, protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Send(&wsMessage{Field1: strings.Repeat("x", mynet.DefaultWebSocketMessageSize)})
+	if err = <-errChan; !errors.Is(err, mynet.ErrWebSocketTooLarge) {
+		t.Fatalf("receive err = %v", err)
+	}
+}